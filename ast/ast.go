@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/hudsn/learn-interpreter/token"
 )
@@ -35,26 +36,58 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+// String renders the program as source that parses back into an equivalent
+// program, though not necessarily the same text: grouping is made explicit
+// with parentheses and pipes appear as the calls they stand for.
 func (p *Program) String() string {
+	return joinStatements(p.Statements)
+}
+
+// joinStatements renders statements in order, adding the semicolon that an
+// expression statement doesn't print itself wherever another statement
+// follows; without it, "f" and "(x)" would read back as the call "f(x)".
+func joinStatements(statements []Statement) string {
 	var out bytes.Buffer
-	for _, s := range p.Statements {
-		if _, err := out.WriteString(s.String()); err != nil {
-			break
+	for i, s := range statements {
+		str := s.String()
+		out.WriteString(str)
+		if i < len(statements)-1 && !strings.HasSuffix(str, ";") {
+			out.WriteString("; ")
 		}
 	}
 	return out.String()
 }
 
+// braced renders a block with its braces, for nodes that print their own
+// block delimiters.
+func braced(bs *BlockStatement) string {
+	if len(bs.Statements) == 0 {
+		return "{}"
+	}
+	return "{ " + bs.String() + " }"
+}
+
 // IDENT
 
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Annotation is the optional type name written after a let, const, or
+	// parameter name, as in let x: Int = 5. It documents intent only and is
+	// never checked.
+	Annotation string
+	// Default is the value a function parameter takes when the caller omits
+	// it, as in fn(a, b = 10). It is nil for required parameters and for
+	// every identifier outside a parameter list.
+	Default Expression
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string {
+	if i.Annotation != "" {
+		return i.Value + ": " + i.Annotation
+	}
 	return i.Value
 }
 
@@ -82,6 +115,66 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// DestructuringLetStatement binds several names at once, either to the
+// elements of an array (let [a, b] = ...) or to the values under the
+// same-named string keys of a hash (let {x, y} = ...).
+type DestructuringLetStatement struct {
+	Token    token.Token // the 'let' token
+	Names    []*Identifier
+	FromHash bool
+	Value    Expression
+}
+
+func (ds *DestructuringLetStatement) statementNode()       {}
+func (ds *DestructuringLetStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DestructuringLetStatement) String() string {
+	var out bytes.Buffer
+
+	names := []string{}
+	for _, name := range ds.Names {
+		names = append(names, name.String())
+	}
+
+	open, close := "[", "]"
+	if ds.FromHash {
+		open, close = "{", "}"
+	}
+
+	out.WriteString(ds.TokenLiteral() + " ")
+	out.WriteString(open + strings.Join(names, ", ") + close)
+	out.WriteString(" = ")
+	if ds.Value != nil {
+		out.WriteString(ds.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// CONST
+
+type ConstStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
 // RETURN
 type ReturnStatement struct {
 	Token       token.Token
@@ -93,13 +186,51 @@ func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(rs.TokenLiteral() + " ")
-	out.WriteString(rs.ReturnValue.String())
+	out.WriteString(rs.TokenLiteral())
+	if rs.ReturnValue != nil {
+		out.WriteString(" " + rs.ReturnValue.String())
+	}
 	out.WriteString(";")
 
 	return out.String()
 }
 
+// SWITCH
+type SwitchStatement struct {
+	Token   token.Token
+	Subject Expression
+	Cases   []*CaseClause
+	Default *BlockStatement
+}
+
+func (ss *SwitchStatement) statementNode()       {}
+func (ss *SwitchStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SwitchStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch (" + ss.Subject.String() + ") {")
+	for _, c := range ss.Cases {
+		out.WriteString(c.String())
+	}
+	if ss.Default != nil {
+		out.WriteString("default: " + ss.Default.String() + ";")
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+type CaseClause struct {
+	Token token.Token
+	Value Expression
+	Body  *BlockStatement
+}
+
+func (cc *CaseClause) TokenLiteral() string { return cc.Token.Literal }
+func (cc *CaseClause) String() string {
+	return "case " + cc.Value.String() + ": " + cc.Body.String() + ";"
+}
+
 // BLOCK STATEMENT
 type BlockStatement struct {
 	Token      token.Token
@@ -107,14 +238,10 @@ type BlockStatement struct {
 }
 
 func (bs *BlockStatement) statementNode() {}
-func (bs *BlockStatement) String() string {
-	var out bytes.Buffer
-
-	for _, statement := range bs.Statements {
-		out.WriteString(statement.String())
-	}
 
-	return out.String()
+// String renders the block's statements without the surrounding braces.
+func (bs *BlockStatement) String() string {
+	return joinStatements(bs.Statements)
 }
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
@@ -182,6 +309,20 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression writes Value into Target, which is either an existing
+// identifier or an index expression such as arr[0] or hash["key"].
+type AssignExpression struct {
+	Token  token.Token // the '=' token
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Target.String() + " = " + ae.Value.String() + ")"
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -195,11 +336,22 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
 	Consequence *BlockStatement
 	Alternative *BlockStatement
+	// ElseIf holds the next link of an `else if` chain. It is never set
+	// together with Alternative.
+	ElseIf *IfExpression
 }
 
 func (ie *IfExpression) expressionNode()      {}
@@ -207,22 +359,54 @@ func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("if")
-	out.WriteString(ie.Condition.String() + " ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString("if (" + ie.Condition.String() + ") ")
+	out.WriteString(braced(ie.Consequence))
 
 	if ie.Alternative != nil {
-		out.WriteString("else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(" else ")
+		out.WriteString(braced(ie.Alternative))
+	}
+	if ie.ElseIf != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.ElseIf.String())
 	}
 
 	return out.String()
 }
 
+type TryExpression struct {
+	Token token.Token
+	Block *BlockStatement
+	Param *Identifier
+	// CodeParam optionally receives the error's code, as in catch (e, code).
+	CodeParam *Identifier
+	Handler   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(braced(te.Block))
+	out.WriteString(" catch (" + te.Param.String())
+	if te.CodeParam != nil {
+		out.WriteString(", " + te.CodeParam.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(braced(te.Handler))
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
-	Body       *BlockStatement
+	// Variadic marks the last parameter as a rest parameter that collects any
+	// remaining arguments into an array.
+	Variadic bool
+	Body     *BlockStatement
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -232,22 +416,37 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		params = append(params, ParameterString(p))
+	}
+	if fl.Variadic {
+		params[len(params)-1] = "..." + params[len(params)-1]
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
-	out.WriteString(fl.Body.String())
+	out.WriteString(braced(fl.Body))
 
 	return out.String()
 }
 
+// ParameterString renders a function parameter with its default value, if
+// it has one.
+func ParameterString(p *Identifier) string {
+	if p.Default != nil {
+		return p.String() + " = " + p.Default.String()
+	}
+	return p.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	// Tail is set by the parser when the call's result is returned directly
+	// from the enclosing function literal.
+	Tail bool
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -277,7 +476,34 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
-func (sl *StringLiteral) String() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string { return quote(sl.Value) }
+
+// quote renders s as a string literal using only escapes the lexer decodes.
+// Bytes that aren't valid UTF-8 are written as \x escapes so they survive.
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == utf8.RuneError && size == 1, r < 0x20, r == 0x7f:
+			fmt.Fprintf(&out, `\x%02x`, s[i])
+		default:
+			out.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	out.WriteByte('"')
+	return out.String()
+}
 
 type ArrayLiteral struct {
 	Token    token.Token
@@ -298,15 +524,32 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
 
+// SpreadExpression expands a collection in place inside an array literal,
+// hash literal, or call's argument list: [...a, 4], {...h, "k": 1}, f(...args).
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 type IndexExpression struct {
 	Token token.Token
 	Left  Expression
 	Index Expression
+	// Optional is set for x?[i], which evaluates to null instead of failing
+	// when x is null.
+	Optional bool
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IndexExpression) String() string {
+	if ie.Optional {
+		return fmt.Sprintf("(%s?[%s])", ie.Left.String(), ie.Index.String())
+	}
 	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
 }
 
@@ -327,6 +570,9 @@ func (ae *ArrayExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	// Order lists the entries in source order: each key of Pairs, and each
+	// *SpreadExpression, which has no entry in Pairs.
+	Order []Expression
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -336,8 +582,12 @@ func (hl *HashLiteral) TokenLiteral() string {
 }
 func (hl *HashLiteral) String() string {
 	pairStrings := []string{}
-	for key, val := range hl.Pairs {
-		msg := fmt.Sprintf("%s: %s", key.String(), val.String())
+	for _, key := range hl.Order {
+		if spread, ok := key.(*SpreadExpression); ok {
+			pairStrings = append(pairStrings, spread.String())
+			continue
+		}
+		msg := fmt.Sprintf("%s: %s", key.String(), hl.Pairs[key].String())
 		pairStrings = append(pairStrings, msg)
 	}
 
@@ -1,40 +1,47 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/hudsn/learn-interpreter/object"
 )
 
 var builtins = map[string]*object.Builtin{
-	"puts": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return NULL
-		},
-	},
 	"len": {
+		Doc: "len(x): number of characters in a string, elements in an array, or pairs in a hash",
+		// len counts strings by rune, matching indexing, slice and reverse.
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newError(object.TYPE_ERROR, "argument to `len` must be STRING, ARRAY, or HASH, got %s", args[0].Type())
 			}
 		},
 	},
 	"first": {
+		Doc: "first(arr): first element of an array, or null when empty",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d. want=1", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d. want=1", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -44,14 +51,15 @@ var builtins = map[string]*object.Builtin{
 				}
 				return arg.Elements[0]
 			default:
-				return newError("argument to `first` must be ARRAY, got %s", arg.Type())
+				return newError(object.TYPE_ERROR, "argument to `first` must be ARRAY, got %s", arg.Type())
 			}
 		},
 	},
 	"last": {
+		Doc: "last(arr): last element of an array, or null when empty",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d. want=1", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d. want=1", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -61,34 +69,64 @@ var builtins = map[string]*object.Builtin{
 				}
 				return arg.Elements[len(arg.Elements)-1]
 			default:
-				return newError("argument to `last` must be ARRAY, got %s", arg.Type())
+				return newError(object.TYPE_ERROR, "argument to `last` must be ARRAY, got %s", arg.Type())
 			}
 		},
 	},
 	"rest": {
+		Doc: "rest(arr): new array of every element but the first",
+		// rest of an empty array is an empty array, so rest can be applied
+		// repeatedly without checking for null.
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d. want=1", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d. want=1", len(args))
 			}
 
 			switch arg := args[0].(type) {
 			case *object.Array:
 				length := len(arg.Elements)
 				if length <= 0 {
-					return NULL
+					return &object.Array{Elements: []object.Object{}}
 				}
 				newElements := make([]object.Object, length-1)
 				copy(newElements, arg.Elements[1:])
 				return &object.Array{Elements: newElements}
 			default:
-				return newError("argument to `rest` must be ARRAY, got %s", arg.Type())
+				return newError(object.TYPE_ERROR, "argument to `rest` must be ARRAY, got %s", arg.Type())
+			}
+		},
+	},
+	"take": {
+		Doc: "take(arr, n): new array of the first n elements, or the last -n when n is negative",
+		Fn: func(args ...object.Object) object.Object {
+			arr, split, err := splitPoint("take", args)
+			if err != nil {
+				return err
+			}
+			if args[1].(*object.Integer).Value < 0 {
+				return copyElements(arr.Elements[split:])
 			}
+			return copyElements(arr.Elements[:split])
+		},
+	},
+	"drop": {
+		Doc: "drop(arr, n): new array without the first n elements, or the last -n when n is negative",
+		Fn: func(args ...object.Object) object.Object {
+			arr, split, err := splitPoint("drop", args)
+			if err != nil {
+				return err
+			}
+			if args[1].(*object.Integer).Value < 0 {
+				return copyElements(arr.Elements[:split])
+			}
+			return copyElements(arr.Elements[split:])
 		},
 	},
 	"push": {
+		Doc: "push(arr, x): new array with x appended",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d. want=2", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d. want=2", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -99,8 +137,1487 @@ var builtins = map[string]*object.Builtin{
 				newElements[length] = args[1]
 				return &object.Array{Elements: newElements}
 			default:
-				return newError("argument to `push` must be ARRAY, got %s", arg.Type())
+				return newError(object.TYPE_ERROR, "argument to `push` must be ARRAY, got %s", arg.Type())
+			}
+		},
+	},
+	"abs": {
+		Doc: "abs(n): absolute value of an integer",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				if arg.Value == math.MinInt64 {
+					return newError(object.VALUE_ERROR, "integer overflow")
+				}
+				if arg.Value < 0 {
+					return &object.Integer{Value: -arg.Value}
+				}
+				return arg
+			default:
+				return newError(object.TYPE_ERROR, "argument to `abs` must be INTEGER, got %s", arg.Type())
+			}
+		},
+	},
+	"min": {
+		Doc: "min(a, b, ...): smallest of two or more integers",
+		Fn: func(args ...object.Object) object.Object {
+			return extremeInteger("min", args, func(a, b int64) bool { return a < b })
+		},
+	},
+	"max": {
+		Doc: "max(a, b, ...): largest of two or more integers",
+		Fn: func(args ...object.Object) object.Object {
+			return extremeInteger("max", args, func(a, b int64) bool { return a > b })
+		},
+	},
+	"gcd": {
+		Doc: "gcd(a, b): greatest common divisor of two integers; gcd(0, 0) is 0",
+		Fn: func(args ...object.Object) object.Object {
+			a, b, err := integerPair("gcd", args)
+			if err != nil {
+				return err
+			}
+
+			g := gcd(absUint(a), absUint(b))
+			if g > math.MaxInt64 {
+				return newError(object.VALUE_ERROR, "integer overflow")
+			}
+			return &object.Integer{Value: int64(g)}
+		},
+	},
+	"lcm": {
+		Doc: "lcm(a, b): least common multiple of two integers; 0 if either is 0",
+		Fn: func(args ...object.Object) object.Object {
+			a, b, err := integerPair("lcm", args)
+			if err != nil {
+				return err
+			}
+			if a == 0 || b == 0 {
+				return &object.Integer{Value: 0}
+			}
+
+			x, y := absUint(a), absUint(b)
+			hi, lo := bits.Mul64(x/gcd(x, y), y)
+			if hi != 0 || lo > math.MaxInt64 {
+				return newError(object.VALUE_ERROR, "integer overflow")
+			}
+			return &object.Integer{Value: int64(lo)}
+		},
+	},
+	"pow": {
+		Doc: "pow(base, exp [, mod]): base raised to exp, reduced modulo mod when given",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2 or 3", len(args))
+			}
+			for _, arg := range args {
+				if _, ok := arg.(*object.Integer); !ok {
+					return newError(object.TYPE_ERROR, "arguments to `pow` must be INTEGER, got %s", arg.Type())
+				}
+			}
+
+			base := args[0].(*object.Integer).Value
+			exp := args[1].(*object.Integer).Value
+			if exp < 0 {
+				return newError(object.VALUE_ERROR, "second argument to `pow` must not be negative, got %d", exp)
+			}
+
+			if len(args) == 2 {
+				result, ok := powInt64(base, exp)
+				if !ok {
+					return newError(object.VALUE_ERROR, "integer overflow")
+				}
+				return &object.Integer{Value: result}
+			}
+
+			mod := args[2].(*object.Integer).Value
+			if mod <= 0 {
+				return newError(object.VALUE_ERROR, "third argument to `pow` must be positive, got %d", mod)
+			}
+			// big.Int keeps the intermediate products from overflowing, and
+			// Mod first makes a negative base give a result in [0, mod).
+			m := big.NewInt(mod)
+			b := new(big.Int).Mod(big.NewInt(base), m)
+			result := new(big.Int).Exp(b, big.NewInt(exp), m)
+			return &object.Integer{Value: result.Int64()}
+		},
+	},
+	"range": {
+		Doc: "range([start,] end [, step]): array of integers from start up to end",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1 to 3", len(args))
+			}
+
+			bounds := []int64{}
+			for _, arg := range args {
+				integer, ok := arg.(*object.Integer)
+				if !ok {
+					return newError(object.TYPE_ERROR, "arguments to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds = append(bounds, integer.Value)
+			}
+
+			var start, end, step int64 = 0, 0, 1
+			switch len(bounds) {
+			case 1:
+				end = bounds[0]
+			case 2:
+				start, end = bounds[0], bounds[1]
+			case 3:
+				start, end, step = bounds[0], bounds[1], bounds[2]
+			}
+
+			if step == 0 {
+				return newError(object.VALUE_ERROR, "`range` step must not be zero")
+			}
+
+			length := rangeLength(start, end, step)
+			if length > maxArrayLength {
+				return newError(object.VALUE_ERROR, "`range` would produce %d elements, more than the limit of %d", length, maxArrayLength)
+			}
+
+			elements := make([]object.Object, length)
+			i := start
+			for idx := range elements {
+				elements[idx] = &object.Integer{Value: i}
+				i += step
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"replace": {
+		Doc: "replace(s, old, new): s with every old replaced by new",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=3", len(args))
+			}
+
+			strs, err := stringArgs("replace", args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+		},
+	},
+	"split": {
+		Doc: "split(s, sep): array of the parts of s between each sep",
+		// split follows strings.Split: an empty string splits into [""], and
+		// an empty separator splits into single characters. join undoes it.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			strs, err := stringArgs("split", args)
+			if err != nil {
+				return err
+			}
+
+			return stringArray(strings.Split(strs[0], strs[1]))
+		},
+	},
+	"join": {
+		Doc: "join(arr, sep): the strings in arr joined with sep",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "first argument to `join` must be ARRAY, got %s", args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "second argument to `join` must be STRING, got %s", args[1].Type())
+			}
+
+			parts := make([]string, len(arr.Elements))
+			for i, el := range arr.Elements {
+				str, ok := el.(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "elements of the array passed to `join` must be STRING, got %s", el.Type())
+				}
+				parts[i] = str.Value
+			}
+			return &object.String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+	"lines": {
+		Doc: "lines(s): array of the lines in s, without their \\n or \\r\\n endings",
+		// A final line ending doesn't start another line, so text read from
+		// a file gives the same lines whether or not it ends in a newline.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			strs, err := stringArgs("lines", args)
+			if err != nil {
+				return err
+			}
+
+			if strs[0] == "" {
+				return &object.Array{Elements: []object.Object{}}
+			}
+			lines := strings.Split(strings.TrimSuffix(strs[0], "\n"), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSuffix(line, "\r")
+			}
+			return stringArray(lines)
+		},
+	},
+	"words": {
+		Doc: "words(s): array of the whitespace-separated words in s",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			strs, err := stringArgs("words", args)
+			if err != nil {
+				return err
+			}
+			return stringArray(strings.Fields(strs[0]))
+		},
+	},
+	"trim": {
+		Doc: "trim(s [, chars]): s without leading and trailing whitespace or chars",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			strs, err := stringArgs("trim", args)
+			if err != nil {
+				return err
+			}
+			if len(strs) == 2 {
+				return &object.String{Value: strings.Trim(strs[0], strs[1])}
+			}
+			return &object.String{Value: strings.TrimSpace(strs[0])}
+		},
+	},
+	"entries": {
+		Doc: "entries(hash): array of [key, value] pairs",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Hash:
+				entries := []object.Object{}
+				for _, pair := range arg.OrderedPairs() {
+					entry := &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+					entries = append(entries, entry)
+				}
+				return &object.Array{Elements: entries}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `entries` must be HASH, got %s", arg.Type())
+			}
+		},
+	},
+	"keys": {
+		Doc: "keys(hash): array of the keys in insertion order",
+		Fn: func(args ...object.Object) object.Object {
+			return hashColumn("keys", args, func(pair object.HashPair) object.Object { return pair.Key })
+		},
+	},
+	"values": {
+		Doc: "values(hash): array of the values in insertion order",
+		Fn: func(args ...object.Object) object.Object {
+			return hashColumn("values", args, func(pair object.HashPair) object.Object { return pair.Value })
+		},
+	},
+	"equals": {
+		Doc: "equals(a, b): whether a and b are deeply equal",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+			return nativeBoolToBooleanObject(objectsEqual(args[0], args[1]))
+		},
+	},
+	"array": {
+		Doc: "array(n [, init]): array of n elements, each a copy of init or null",
+		// Each element gets its own deep copy of init, so array(3, []) holds
+		// three separate arrays rather than one array three times.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError(object.TYPE_ERROR, "first argument to `array` must be INTEGER, got %s", args[0].Type())
+			}
+			if n.Value < 0 {
+				return newError(object.VALUE_ERROR, "first argument to `array` must not be negative, got %d", n.Value)
+			}
+			if n.Value > maxArrayLength {
+				return newError(object.VALUE_ERROR, "first argument to `array` must be at most %d, got %d", maxArrayLength, n.Value)
+			}
+
+			var init object.Object = NULL
+			if len(args) == 2 {
+				init = args[1]
+			}
+
+			elements := make([]object.Object, n.Value)
+			for i := range elements {
+				elements[i] = deepCopy(init)
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"hash": {
+		Doc: "hash(): a new empty hash",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=0", len(args))
+			}
+			return &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+		},
+	},
+	"clone": {
+		Doc: "clone(x): deep copy of an array or hash",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return deepCopy(args[0])
+		},
+	},
+	"reverse": {
+		Doc: "reverse(x): a string or array in reverse order",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				length := len(arg.Elements)
+				reversed := make([]object.Object, length)
+				for i, el := range arg.Elements {
+					reversed[length-1-i] = el
+				}
+				return &object.Array{Elements: reversed}
+			case *object.String:
+				runes := []rune(arg.Value)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return &object.String{Value: string(runes)}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `reverse` must be ARRAY or STRING, got %s", arg.Type())
+			}
+		},
+	},
+	"index": {
+		Doc: "index(x, item): position of item in a string or array, or -1",
+		// index returns the position of the first match, or -1 when there is
+		// none. Strings are searched by rune offset to agree with indexing.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				for i, el := range arg.Elements {
+					if objectsEqual(el, args[1]) {
+						return &object.Integer{Value: int64(i)}
+					}
+				}
+				return &object.Integer{Value: -1}
+			case *object.String:
+				substr, ok := args[1].(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "second argument to `index` must be STRING when searching a STRING, got %s", args[1].Type())
+				}
+				offset := strings.Index(arg.Value, substr.Value)
+				if offset < 0 {
+					return &object.Integer{Value: -1}
+				}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value[:offset]))}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `index` must be ARRAY or STRING, got %s", arg.Type())
+			}
+		},
+	},
+	"ord": {
+		Doc: "ord(ch): character code of a one-character string",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `ord` must be STRING, got %s", args[0].Type())
+			}
+			if utf8.RuneCountInString(str.Value) != 1 {
+				return newError(object.VALUE_ERROR, "argument to `ord` must be a single character, got %q", str.Value)
+			}
+
+			r, _ := utf8.DecodeRuneInString(str.Value)
+			return &object.Integer{Value: int64(r)}
+		},
+	},
+	"chr": {
+		Doc: "chr(n): one-character string for a character code",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			code, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `chr` must be INTEGER, got %s", args[0].Type())
+			}
+			if code.Value < 0 || code.Value > utf8.MaxRune || !utf8.ValidRune(rune(code.Value)) {
+				return newError(object.VALUE_ERROR, "invalid code point for `chr`: %d", code.Value)
+			}
+
+			return &object.String{Value: string(rune(code.Value))}
+		},
+	},
+	"assert": {
+		Doc: "assert(cond [, message]): fail with message unless cond is truthy",
+		// assert fails with message, or a generic one, when cond is falsy.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			message := "assertion failed"
+			if len(args) == 2 {
+				str, ok := args[1].(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "second argument to `assert` must be STRING, got %s", args[1].Type())
+				}
+				message = str.Value
+			}
+
+			if !isTruthy(args[0]) {
+				return newError(object.ASSERTION_ERROR, "%s", message)
+			}
+			return NULL
+		},
+	},
+	"zip": {
+		Doc: "zip(a, b): array of [a[i], b[i]] pairs, as long as the shorter array",
+		// zip pairs up elements by position, stopping at the shorter array.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			arrays := make([]*object.Array, 2)
+			for i, arg := range args {
+				arr, ok := arg.(*object.Array)
+				if !ok {
+					return newError(object.TYPE_ERROR, "arguments to `zip` must be ARRAY, got %s", arg.Type())
+				}
+				arrays[i] = arr
+			}
+
+			length := len(arrays[0].Elements)
+			if len(arrays[1].Elements) < length {
+				length = len(arrays[1].Elements)
+			}
+
+			pairs := make([]object.Object, length)
+			for i := range pairs {
+				pairs[i] = &object.Array{Elements: []object.Object{arrays[0].Elements[i], arrays[1].Elements[i]}}
+			}
+			return &object.Array{Elements: pairs}
+		},
+	},
+	"enumerate": {
+		Doc: "enumerate(arr): array of [index, element] pairs",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `enumerate` must be ARRAY, got %s", args[0].Type())
+			}
+
+			pairs := make([]object.Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				pairs[i] = &object.Array{Elements: []object.Object{&object.Integer{Value: int64(i)}, el}}
+			}
+			return &object.Array{Elements: pairs}
+		},
+	},
+	"flatten": {
+		Doc: "flatten(arr [, depth]): new array with nested arrays spliced in, depth levels deep; -1 flattens fully",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "first argument to `flatten` must be ARRAY, got %s", args[0].Type())
+			}
+
+			depth := int64(1)
+			if len(args) == 2 {
+				d, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError(object.TYPE_ERROR, "second argument to `flatten` must be INTEGER, got %s", args[1].Type())
+				}
+				if d.Value < -1 {
+					return newError(object.VALUE_ERROR, "second argument to `flatten` must be -1 or more, got %d", d.Value)
+				}
+				depth = d.Value
+			}
+
+			return &object.Array{Elements: flattenElements([]object.Object{}, arr.Elements, depth)}
+		},
+	},
+	"bool": {
+		Doc: "bool(x): truthiness of x; only null and false are falsy",
+		// bool converts its argument using the same rules as if conditions.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return nativeBoolToBooleanObject(isTruthy(args[0]))
+		},
+	},
+	"int": {
+		Doc: "int(x): integer parsed from a string, which may use 0x, 0o, 0b and _ like literals, or 1 or 0 for a boolean",
+		// int trims surrounding whitespace, so int(" 42\n") is 42, then
+		// accepts an optional sign followed by the integer literal syntax.
+		// It is the only way to use a boolean as a number.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.Boolean:
+				if arg.Value {
+					return &object.Integer{Value: 1}
+				}
+				return &object.Integer{Value: 0}
+			case *object.String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 0, 64)
+				if errors.Is(err, strconv.ErrRange) {
+					return newError(object.VALUE_ERROR, "integer out of range: %q", arg.Value)
+				}
+				if err != nil {
+					return newError(object.VALUE_ERROR, "cannot parse %q as INTEGER", arg.Value)
+				}
+				return &object.Integer{Value: value}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `int` must be STRING, INTEGER, or BOOLEAN, got %s", arg.Type())
+			}
+		},
+	},
+	"not": {
+		Doc: "not(x): the negated truthiness of x, like !x",
+		// not is the function form of the ! operator.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return evalBangOperatorExpression(args[0])
+		},
+	},
+	"format": {
+		Doc: "format(template, args...): template with each {} replaced by the next argument",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least 1", len(args))
+			}
+
+			template, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "first argument to `format` must be STRING, got %s", args[0].Type())
+			}
+
+			return formatTemplate(template.Value, args[1:])
+		},
+	},
+	"upper": {Fn: caseBuiltin("upper", strings.ToUpper), Doc: "upper(s): s in upper case"},
+	"lower": {Fn: caseBuiltin("lower", strings.ToLower), Doc: "lower(s): s in lower case"},
+	"slice": {
+		Doc: "slice(x, low [, high]): part of a string or array; negative bounds count from the end",
+		// slice returns collection[low:high]. A null high means the end, and
+		// negative bounds count back from the end. Strings slice by rune.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2 or 3", len(args))
+			}
+
+			var length int64
+			switch arg := args[0].(type) {
+			case *object.Array:
+				length = int64(len(arg.Elements))
+			case *object.String:
+				length = int64(utf8.RuneCountInString(arg.Value))
+			default:
+				return newError(object.TYPE_ERROR, "first argument to `slice` must be ARRAY or STRING, got %s", arg.Type())
+			}
+
+			low, high, err := sliceBounds(args[1:], length)
+			if err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				elements := make([]object.Object, high-low)
+				copy(elements, arg.Elements[low:high])
+				return &object.Array{Elements: elements}
+			default:
+				runes := []rune(arg.(*object.String).Value)
+				return &object.String{Value: string(runes[low:high])}
 			}
 		},
 	},
+	"startswith": {Fn: stringPredicate("startswith", strings.HasPrefix), Doc: "startswith(s, prefix): whether s begins with prefix"},
+	"endswith":   {Fn: stringPredicate("endswith", strings.HasSuffix), Doc: "endswith(s, suffix): whether s ends with suffix"},
+	"contains": {
+		Doc: "contains(x, item): whether a string has a substring or an array has an element",
+		// contains tests for a substring in a string or an element in an array.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				return stringPredicate("contains", strings.Contains)(args...)
+			case *object.Array:
+				for _, el := range arg.Elements {
+					if objectsEqual(el, args[1]) {
+						return TRUE
+					}
+				}
+				return FALSE
+			default:
+				return newError(object.TYPE_ERROR, "first argument to `contains` must be STRING or ARRAY, got %s", arg.Type())
+			}
+		},
+	},
+	"count": {
+		Doc: "count(x, item): occurrences of a substring in a string or an element in an array",
+		// count counts non-overlapping substrings, so count("aaa", "aa") is 1.
+		// An empty substring matches between every character, as in Go.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				substr, ok := args[1].(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "second argument to `count` must be STRING when counting in a STRING, got %s", args[1].Type())
+				}
+				return &object.Integer{Value: int64(strings.Count(arg.Value, substr.Value))}
+			case *object.Array:
+				n := 0
+				for _, el := range arg.Elements {
+					if objectsEqual(el, args[1]) {
+						n++
+					}
+				}
+				return &object.Integer{Value: int64(n)}
+			default:
+				return newError(object.TYPE_ERROR, "first argument to `count` must be STRING or ARRAY, got %s", arg.Type())
+			}
+		},
+	},
+	"iter":  {Fn: iter, Doc: "iter(fn): iterator over the values fn returns until it returns null"},
+	"floor": {Fn: roundingBuiltin("floor"), Doc: "floor(n): n rounded down"},
+	"ceil":  {Fn: roundingBuiltin("ceil"), Doc: "ceil(n): n rounded up"},
+	"round": {Fn: roundingBuiltin("round"), Doc: "round(n): n rounded to the nearest integer"},
+	"arity": {
+		Doc: "arity(fn): number of parameters fn takes, or -1 if it is variadic",
+		// arity returns a function's parameter count, or -1 when it accepts
+		// a variable number of arguments (variadic functions and builtins).
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch fn := args[0].(type) {
+			case *object.Function:
+				if fn.Variadic {
+					return &object.Integer{Value: -1}
+				}
+				return &object.Integer{Value: int64(len(fn.Parameters))}
+			case *object.Builtin:
+				return &object.Integer{Value: -1}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `arity` must be FUNCTION, got %s", fn.Type())
+			}
+		},
+	},
+	"params": {
+		Doc: "params(fn): array of fn's parameter names",
+		// params returns a function's parameter names. A rest parameter keeps
+		// its ... prefix.
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			fn, ok := args[0].(*object.Function)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `params` must be FUNCTION, got %s", args[0].Type())
+			}
+
+			names := make([]object.Object, len(fn.Parameters))
+			for i, p := range fn.Parameters {
+				names[i] = &object.String{Value: p.Value}
+			}
+			if fn.Variadic {
+				last := names[len(names)-1].(*object.String)
+				last.Value = "..." + last.Value
+			}
+			return &object.Array{Elements: names}
+		},
+	},
+}
+
+// ioBuiltins reach the host's filesystem, so they are only added when
+// Options.AllowIO is set.
+var ioBuiltins = map[string]*object.Builtin{
+	"read_file": {
+		Doc: "read_file(path): contents of the file at path as a string",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			strs, err := stringArgs("read_file", args)
+			if err != nil {
+				return err
+			}
+
+			contents, readErr := os.ReadFile(strs[0])
+			if readErr != nil {
+				return newError(object.IO_ERROR, "%s", readErr)
+			}
+			return &object.String{Value: string(contents)}
+		},
+	},
+	"write_file": {
+		Doc: "write_file(path, s): replace the file at path with the string s, creating it if needed",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			strs, err := stringArgs("write_file", args)
+			if err != nil {
+				return err
+			}
+
+			if writeErr := os.WriteFile(strs[0], []byte(strs[1]), 0o644); writeErr != nil {
+				return newError(object.IO_ERROR, "%s", writeErr)
+			}
+			return NULL
+		},
+	},
+}
+
+// boundBuiltins returns the builtins that need the evaluator itself, either
+// to write to its output or to call back into user functions.
+func (e *Evaluator) boundBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"puts":    {Fn: e.puts, Doc: "puts(args...): print each argument on its own line"},
+		"print":   {Fn: e.print, Doc: "print(args...): print the arguments without a trailing newline"},
+		"input":   {Fn: e.readLine, Doc: "input([prompt]): print prompt, then read a line of input, or null at end of input"},
+		"times":   {Fn: e.times, Doc: "times(n, fn): call fn(i) for each i from 0 to n-1"},
+		"map":     {Fn: e.mapArray, Doc: "map(arr, fn): new array of fn applied to each element"},
+		"filter":  {Fn: e.filterArray, Doc: "filter(arr, fn): new array of the elements for which fn is truthy"},
+		"next":    {Fn: e.next, Doc: "next(it): next value from an iterator, or null when exhausted"},
+		"random":  {Fn: e.randomInt, Doc: "random(n): random integer from 0 to n-1"},
+		"now":     {Fn: e.nowMillis, Doc: "now(): current Unix time in milliseconds"},
+		"sleep":   {Fn: e.sleepMillis, Doc: "sleep(ms): pause for ms milliseconds"},
+		"partial": {Fn: e.partial, Doc: "partial(fn, args...): fn with args bound as its first arguments"},
+		"memoize": {Fn: e.memoize, Doc: "memoize(fn): fn with its results cached by argument values"},
+		"recur":   {Fn: e.recur, Doc: "recur(args...): call the innermost running function again, even if it has no name"},
+		"compose": {Fn: e.compose, Doc: "compose(f, g, ...): function applying its arguments right to left"},
+	}
+}
+
+// memoize returns a builtin that calls fn once per distinct argument list and
+// replays the result afterwards. Calls with an argument that can't be a hash
+// key, such as an array, always reach fn; errors are never cached.
+func (e *Evaluator) memoize(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	fn := args[0]
+	if !isCallable(fn) {
+		return newError(object.TYPE_ERROR, "argument to `memoize` must be FUNCTION, got %s", fn.Type())
+	}
+
+	cache := make(map[string]object.Object)
+	return &object.Builtin{Fn: func(callArgs ...object.Object) object.Object {
+		key, ok := argumentsKey(callArgs)
+		if !ok {
+			return e.applyFunction(fn, callArgs)
+		}
+		if result, ok := cache[key]; ok {
+			return result
+		}
+
+		result := e.applyFunction(fn, callArgs)
+		if !isError(result) {
+			cache[key] = result
+		}
+		return result
+	}}
+}
+
+// argumentsKey combines the hash keys of args into one cache key, reporting
+// false if any argument isn't hashable.
+func argumentsKey(args []object.Object) (string, bool) {
+	var key strings.Builder
+	for _, arg := range args {
+		hashable, ok := arg.(object.Hashable)
+		if !ok {
+			return "", false
+		}
+		hashKey := hashable.HashKey()
+		fmt.Fprintf(&key, "%s:%d;", hashKey.Type, hashKey.Value)
+	}
+	return key.String(), true
+}
+
+// recur applies the innermost user function being evaluated, which lets
+// anonymous functions call themselves.
+func (e *Evaluator) recur(args ...object.Object) object.Object {
+	if len(e.callStack) == 0 {
+		return newError(object.NAME_ERROR, "`recur` used outside of a function")
+	}
+	return e.applyFunction(e.callStack[len(e.callStack)-1], args)
+}
+
+// compose returns a builtin that applies fns right to left, so compose(f, g)
+// behaves like fn(x) { f(g(x)) }. Only the last function may take more than
+// one argument, since each of the others receives a single result.
+func (e *Evaluator) compose(args ...object.Object) object.Object {
+	if len(args) < 2 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least 2", len(args))
+	}
+
+	for i, fn := range args {
+		if !isCallable(fn) {
+			return newError(object.TYPE_ERROR, "arguments to `compose` must be FUNCTION, got %s", fn.Type())
+		}
+		f, ok := fn.(*object.Function)
+		if !ok || i == len(args)-1 {
+			continue
+		}
+		if err := checkArity(f, []object.Object{NULL}); err != nil {
+			return newError(object.ARITY_ERROR, "argument %d to `compose` must take exactly one argument, got %s", i+1, f.Signature())
+		}
+	}
+
+	return &object.Builtin{Fn: func(callArgs ...object.Object) object.Object {
+		result := e.applyFunction(args[len(args)-1], callArgs)
+		for i := len(args) - 2; i >= 0; i-- {
+			if isError(result) {
+				return result
+			}
+			result = e.applyFunction(args[i], []object.Object{result})
+		}
+		return result
+	}}
+}
+
+// partial returns a builtin that calls fn with the bound arguments followed
+// by the arguments it is called with.
+func (e *Evaluator) partial(args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	fn := args[0]
+	if !isCallable(fn) {
+		return newError(object.TYPE_ERROR, "first argument to `partial` must be FUNCTION, got %s", fn.Type())
+	}
+
+	bound := args[1:]
+	if f, ok := fn.(*object.Function); ok && !f.Variadic && len(bound) > len(f.Parameters) {
+		return newError(object.ARITY_ERROR, "too many arguments to `partial`. got=%d, want at most %d", len(bound), len(f.Parameters))
+	}
+
+	return &object.Builtin{Fn: func(rest ...object.Object) object.Object {
+		callArgs := make([]object.Object, 0, len(bound)+len(rest))
+		callArgs = append(callArgs, bound...)
+		callArgs = append(callArgs, rest...)
+		return e.applyFunction(fn, callArgs)
+	}}
+}
+
+// nowMillis returns the current Unix time in milliseconds.
+func (e *Evaluator) nowMillis(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &object.Integer{Value: e.now().UnixMilli()}
+}
+
+// sleepMillis blocks for the given number of milliseconds.
+func (e *Evaluator) sleepMillis(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(object.TYPE_ERROR, "argument to `sleep` must be INTEGER, got %s", args[0].Type())
+	}
+	if ms.Value < 0 {
+		return newError(object.VALUE_ERROR, "argument to `sleep` must not be negative, got %d", ms.Value)
+	}
+
+	e.sleep(time.Duration(ms.Value) * time.Millisecond)
+	return NULL
+}
+
+// randomInt implements random(n), returning an integer in [0, n). There is
+// no float type yet, so the no-argument form returning [0, 1) isn't offered.
+func (e *Evaluator) randomInt(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(object.TYPE_ERROR, "argument to `random` must be INTEGER, got %s", args[0].Type())
+	}
+	if n.Value <= 0 {
+		return newError(object.VALUE_ERROR, "argument to `random` must be positive, got %d", n.Value)
+	}
+
+	return &object.Integer{Value: e.random.Int63n(n.Value)}
+}
+
+func (e *Evaluator) puts(args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Fprintln(e.output, arg.Inspect())
+	}
+	return NULL
+}
+
+// print writes its arguments separated by spaces, without a newline.
+func (e *Evaluator) print(args ...object.Object) object.Object {
+	for i, arg := range args {
+		if i > 0 {
+			io.WriteString(e.output, " ")
+		}
+		io.WriteString(e.output, arg.Inspect())
+	}
+	return NULL
+}
+
+// readLine prints an optional prompt and returns the next line of input
+// without its line ending. A last line with no newline is still returned;
+// after that, input gives null.
+func (e *Evaluator) readLine(args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 1 {
+		prompt, ok := args[0].(*object.String)
+		if !ok {
+			return newError(object.TYPE_ERROR, "argument to `input` must be STRING, got %s", args[0].Type())
+		}
+		io.WriteString(e.output, prompt.Value)
+	}
+
+	line, err := e.input.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return newError(object.IO_ERROR, "%s", err)
+	}
+	if line == "" && err != nil {
+		return NULL
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
+
+// times calls fn(i) for every i from 0 to n-1 and returns NULL, stopping at
+// the first error.
+func (e *Evaluator) times(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError(object.TYPE_ERROR, "first argument to `times` must be INTEGER, got %s", args[0].Type())
+	}
+	if n.Value < 0 {
+		return newError(object.VALUE_ERROR, "first argument to `times` must not be negative, got %d", n.Value)
+	}
+
+	if !isCallable(args[1]) {
+		return newError(object.TYPE_ERROR, "second argument to `times` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	for i := int64(0); i < n.Value; i++ {
+		result := e.applyFunction(args[1], []object.Object{&object.Integer{Value: i}})
+		if isError(result) {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// mapArray calls fn on each element of an array. fn runs in the environment
+// it was defined in, so closures see their own variables rather than the
+// caller's.
+func (e *Evaluator) mapArray(args ...object.Object) object.Object {
+	arr, fn, err := arrayAndFunction("map", args)
+	if err != nil {
+		return err
+	}
+
+	mapped := make([]object.Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		result := e.applyFunction(fn, []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		mapped[i] = result
+	}
+
+	return &object.Array{Elements: mapped}
+}
+
+// filterArray keeps the elements of an array for which fn returns a truthy
+// value.
+func (e *Evaluator) filterArray(args ...object.Object) object.Object {
+	arr, fn, err := arrayAndFunction("filter", args)
+	if err != nil {
+		return err
+	}
+
+	kept := []object.Object{}
+	for _, el := range arr.Elements {
+		result := e.applyFunction(fn, []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			kept = append(kept, el)
+		}
+	}
+
+	return &object.Array{Elements: kept}
+}
+
+// arrayAndFunction checks the (arr, fn) arguments shared by map and filter.
+func arrayAndFunction(name string, args []object.Object) (*object.Array, object.Object, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newError(object.TYPE_ERROR, "first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return nil, nil, newError(object.TYPE_ERROR, "second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+
+	return arr, args[1], nil
+}
+
+// iter wraps a generator function in an iterator for next to advance.
+func iter(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if !isCallable(args[0]) {
+		return newError(object.TYPE_ERROR, "argument to `iter` must be FUNCTION, got %s", args[0].Type())
+	}
+	if fn, ok := args[0].(*object.Function); ok && requiredParams(fn) > 0 {
+		return newError(object.TYPE_ERROR, "argument to `iter` must take no arguments, got %d", requiredParams(fn))
+	}
+
+	return &object.Iterator{Generator: args[0]}
+}
+
+// next returns the iterator's next value, or null once the generator is exhausted.
+func (e *Evaluator) next(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	it, ok := args[0].(*object.Iterator)
+	if !ok {
+		return newError(object.TYPE_ERROR, "argument to `next` must be ITERATOR, got %s", args[0].Type())
+	}
+	if it.Done {
+		return NULL
+	}
+
+	result := e.applyFunction(it.Generator, []object.Object{})
+	if result == NULL {
+		it.Done = true
+	}
+	return result
+}
+
+// flattenElements appends elements to flat, splicing in the elements of
+// nested arrays up to depth levels down. A negative depth has no limit.
+func flattenElements(flat []object.Object, elements []object.Object, depth int64) []object.Object {
+	for _, el := range elements {
+		if inner, ok := el.(*object.Array); ok && depth != 0 {
+			flat = flattenElements(flat, inner.Elements, depth-1)
+			continue
+		}
+		flat = append(flat, el)
+	}
+	return flat
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatTemplate replaces each {} in template with the next argument's
+// Inspect output. {{ and }} stand for literal braces.
+func formatTemplate(template string, args []object.Object) object.Object {
+	var out strings.Builder
+	placeholders := 0
+
+	for i := 0; i < len(template); i++ {
+		ch := template[i]
+		next := byte(0)
+		if i+1 < len(template) {
+			next = template[i+1]
+		}
+
+		switch {
+		case ch == '{' && next == '{', ch == '}' && next == '}':
+			out.WriteByte(ch)
+			i++
+		case ch == '{' && next == '}':
+			if placeholders < len(args) {
+				out.WriteString(args[placeholders].Inspect())
+			}
+			placeholders++
+			i++
+		case ch == '{' || ch == '}':
+			return newError(object.VALUE_ERROR, "unmatched %q in `format` template", ch)
+		default:
+			out.WriteByte(ch)
+		}
+	}
+
+	if placeholders != len(args) {
+		return newError(object.VALUE_ERROR, "`format` template has %d placeholders, got %d arguments", placeholders, len(args))
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// caseBuiltin builds upper and lower around a Unicode-aware conversion.
+func caseBuiltin(name string, convert func(string) string) object.BuiltInFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return newError(object.TYPE_ERROR, "argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+		return &object.String{Value: convert(str.Value)}
+	}
+}
+
+// sliceBounds resolves slice's low and optional high arguments against length.
+func sliceBounds(args []object.Object, length int64) (int64, int64, *object.Error) {
+	bounds := []int64{0, length}
+	for i, arg := range args {
+		if i == 1 && arg == NULL {
+			continue
+		}
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return 0, 0, newError(object.TYPE_ERROR, "bounds for `slice` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[i] = integer.Value
+		if bounds[i] < 0 {
+			bounds[i] += length
+		}
+	}
+
+	low, high := bounds[0], bounds[1]
+	if low < 0 || high > length || low > high {
+		return 0, 0, newError(object.INDEX_ERROR, "slice bounds out of range [%d:%d] with length %d", low, high, length)
+	}
+	return low, high, nil
+}
+
+// stringPredicate builds a builtin that tests two strings with match.
+func stringPredicate(name string, match func(s, other string) bool) object.BuiltInFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+		}
+
+		strs, err := stringArgs(name, args)
+		if err != nil {
+			return err
+		}
+		return nativeBoolToBooleanObject(match(strs[0], strs[1]))
+	}
+}
+
+// roundingBuiltin builds floor, ceil, and round. The language only has
+// integers so far, which are already whole and come back unchanged.
+func roundingBuiltin(name string) object.BuiltInFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		switch arg := args[0].(type) {
+		case *object.Integer:
+			return arg
+		default:
+			return newError(object.TYPE_ERROR, "argument to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+	}
+}
+
+// hashColumn backs keys and values, picking one side of each pair of the
+// hash argument in insertion order.
+func hashColumn(name string, args []object.Object, pick func(object.HashPair) object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError(object.TYPE_ERROR, "argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	elements := []object.Object{}
+	for _, pair := range hash.OrderedPairs() {
+		elements = append(elements, pick(pair))
+	}
+	return &object.Array{Elements: elements}
+}
+
+// deepCopy copies arrays and hashes recursively. Every other value is
+// immutable from user code, so it is returned as is.
+func deepCopy(obj object.Object) object.Object {
+	return copyValue(obj, map[object.Object]object.Object{})
+}
+
+// copyValue does deepCopy's work. copies maps each array or hash already
+// copied to its copy, so a collection reached twice is copied once and a
+// collection that contains itself doesn't recurse forever.
+func copyValue(obj object.Object, copies map[object.Object]object.Object) object.Object {
+	if copied, ok := copies[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		arr := &object.Array{Elements: make([]object.Object, len(obj.Elements))}
+		copies[obj] = arr
+		for i, el := range obj.Elements {
+			arr.Elements[i] = copyValue(el, copies)
+		}
+		return arr
+	case *object.Hash:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(obj.Pairs))}
+		copies[obj] = hash
+		for _, pair := range obj.OrderedPairs() {
+			hash.Set(pair.Key.(object.Hashable).HashKey(), object.HashPair{Key: pair.Key, Value: copyValue(pair.Value, copies)})
+		}
+		return hash
+	default:
+		return obj
+	}
+}
+
+// maxArrayLength caps the length array and range allocate up front, so an
+// outsized request fails as a Monkey error rather than exhausting the host's
+// memory.
+const maxArrayLength = 1 << 24
+
+// rangeLength counts the elements range produces. It works on the distance
+// between start and end as an unsigned value so that bounds near the ends of
+// the int64 range can't overflow.
+func rangeLength(start, end, step int64) uint64 {
+	var span, stride uint64
+	switch {
+	case step > 0 && start < end:
+		span, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		span, stride = uint64(start)-uint64(end), -uint64(step)
+	default:
+		return 0
+	}
+	return (span-1)/stride + 1
+}
+
+// stringArgs unwraps every argument as a string, failing on the first one that isn't.
+func stringArgs(name string, args []object.Object) ([]string, *object.Error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError(object.TYPE_ERROR, "arguments to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = str.Value
+	}
+	return strs, nil
+}
+
+// integerPair checks the two INTEGER arguments taken by gcd and lcm.
+func integerPair(name string, args []object.Object) (int64, int64, *object.Error) {
+	if len(args) != 2 {
+		return 0, 0, newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	for _, arg := range args {
+		if _, ok := arg.(*object.Integer); !ok {
+			return 0, 0, newError(object.TYPE_ERROR, "arguments to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+	}
+	return args[0].(*object.Integer).Value, args[1].(*object.Integer).Value, nil
+}
+
+// absUint is the absolute value of n, which always fits in a uint64, even
+// for math.MinInt64.
+func absUint(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// powInt64 computes base**exp by repeated squaring, reporting false if the
+// result doesn't fit in an int64.
+func powInt64(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			product := new(big.Int).Mul(big.NewInt(result), big.NewInt(base))
+			if !product.IsInt64() {
+				return 0, false
+			}
+			result = product.Int64()
+		}
+		exp >>= 1
+		if exp > 0 {
+			// the squared base is always used by a later bit, so its
+			// overflow means the result overflows too
+			square := new(big.Int).Mul(big.NewInt(base), big.NewInt(base))
+			if !square.IsInt64() {
+				return 0, false
+			}
+			base = square.Int64()
+		}
+	}
+	return result, true
+}
+
+// splitPoint checks the (arr, n) arguments of take and drop and returns the
+// index n elements from the start of arr, or -n from the end when n is
+// negative, clamped to the array's bounds.
+func splitPoint(name string, args []object.Object) (*object.Array, int, *object.Error) {
+	if len(args) != 2 {
+		return nil, 0, newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, 0, newError(object.TYPE_ERROR, "first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return nil, 0, newError(object.TYPE_ERROR, "second argument to `%s` must be INTEGER, got %s", name, args[1].Type())
+	}
+
+	length := int64(len(arr.Elements))
+	split := n.Value
+	if split < 0 {
+		split = max(length+split, 0)
+	}
+	return arr, int(min(split, length)), nil
+}
+
+func copyElements(elements []object.Object) *object.Array {
+	copied := make([]object.Object, len(elements))
+	copy(copied, elements)
+	return &object.Array{Elements: copied}
+}
+
+func stringArray(strs []string) *object.Array {
+	elements := make([]object.Object, len(strs))
+	for i, str := range strs {
+		elements[i] = &object.String{Value: str}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// extremeInteger returns the argument that wins every comparison made with better.
+// Only integers are supported for now since the language has no float type.
+func extremeInteger(name string, args []object.Object, better func(a, b int64) bool) object.Object {
+	if len(args) < 2 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least 2", len(args))
+	}
+
+	var result *object.Integer
+	for _, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return newError(object.TYPE_ERROR, "arguments to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+		if result == nil || better(integer.Value, result.Value) {
+			result = integer
+		}
+	}
+
+	return result
 }
@@ -1,10 +1,17 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
 
 	"github.com/hudsn/learn-interpreter/ast"
 	"github.com/hudsn/learn-interpreter/object"
+	"github.com/hudsn/learn-interpreter/token"
 )
 
 var (
@@ -13,141 +20,616 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// DefaultMaxCallDepth is the recursion limit used when Options leaves it unset.
+const DefaultMaxCallDepth = 10000
+
+// DefaultMaxOps is the operation budget the REPL and script runner give each
+// program. Tail calls run in a loop rather than adding to the call depth, so
+// this is what stops a function like fn() { f() } from hanging them. Options
+// itself still defaults to no limit.
+const DefaultMaxOps = 50_000_000
+
+// Options configures an Evaluator. The zero value is usable.
+type Options struct {
+	// Output is where builtins like puts write. It defaults to stdout.
+	Output io.Writer
+	// Input is where the input builtin reads lines from. It defaults to
+	// stdin.
+	Input io.Reader
+	// MaxCallDepth bounds how deeply user functions may recurse before
+	// evaluation fails with an error. It defaults to DefaultMaxCallDepth.
+	MaxCallDepth int
+	// MaxOps bounds how many nodes a single program may evaluate before it
+	// fails with "operation limit exceeded", so runaway loops can't hang the
+	// host. Zero means no limit.
+	MaxOps int
+	// AllowIO adds the read_file and write_file builtins. It is off by
+	// default so embedded scripts can't touch the host's filesystem.
+	AllowIO bool
+	// Builtins are made available alongside the standard builtins, replacing
+	// any standard builtin with the same name.
+	Builtins map[string]*object.Builtin
+	// Random is the source for the random builtin. Pass a seeded source for
+	// reproducible results; by default it is seeded from the clock.
+	Random *rand.Rand
+	// Now and Sleep back the now and sleep builtins. They default to
+	// time.Now and time.Sleep; tests can swap in fakes to avoid waiting.
+	Now   func() time.Time
+	Sleep func(time.Duration)
+}
+
+// Evaluator evaluates programs with its own output, recursion limit, and
+// builtins, so several can run independently in one process. A single
+// Evaluator must not be used from more than one goroutine at a time.
+type Evaluator struct {
+	output       io.Writer
+	input        *bufio.Reader
+	maxCallDepth int
+	maxOps       int
+	builtins     map[string]*object.Builtin
+	random       *rand.Rand
+	now          func() time.Time
+	sleep        func(time.Duration)
+
+	// callStack holds the user functions currently being applied, innermost last.
+	// It is bounded by maxCallDepth so runaway recursion becomes a Monkey error
+	// instead of overflowing the Go stack. Tail calls don't add to the depth.
+	callStack []*object.Function
+
+	// ops counts the nodes evaluated by the current program against maxOps.
+	ops int
+}
+
+// New returns an Evaluator configured by opts.
+func New(opts Options) *Evaluator {
+	e := &Evaluator{
+		output:       opts.Output,
+		maxCallDepth: opts.MaxCallDepth,
+		maxOps:       opts.MaxOps,
+		builtins:     make(map[string]*object.Builtin),
+		random:       opts.Random,
+		now:          opts.Now,
+		sleep:        opts.Sleep,
+	}
+	if e.output == nil {
+		e.output = os.Stdout
+	}
+	if opts.Input == nil {
+		opts.Input = os.Stdin
+	}
+	e.input = bufio.NewReader(opts.Input)
+	if e.maxCallDepth == 0 {
+		e.maxCallDepth = DefaultMaxCallDepth
+	}
+	if e.now == nil {
+		e.now = time.Now
+	}
+	if e.sleep == nil {
+		e.sleep = time.Sleep
+	}
+	if e.random == nil {
+		e.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	for name, builtin := range builtins {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.boundBuiltins() {
+		e.builtins[name] = builtin
+	}
+	if opts.AllowIO {
+		for name, builtin := range ioBuiltins {
+			e.builtins[name] = builtin
+		}
+	}
+	for name, builtin := range opts.Builtins {
+		e.builtins[name] = builtin
+	}
+
+	return e
+}
+
+// RegisterBuiltin makes fn callable from Monkey code as name. fn receives the
+// call's arguments as object.Objects and must return an object.Object; an
+// *object.Error return value is raised like any other runtime error. It fails
+// if a builtin with that name already exists.
+func (e *Evaluator) RegisterBuiltin(name string, fn object.BuiltInFunction) error {
+	if _, ok := e.builtins[name]; ok {
+		return fmt.Errorf("builtin %q already exists", name)
+	}
+	e.builtins[name] = &object.Builtin{Fn: fn}
+	return nil
+}
+
+// Builtins returns the builtins available to programs, keyed by name. The map
+// is a copy; changing it does not affect the Evaluator.
+func (e *Evaluator) Builtins() map[string]*object.Builtin {
+	builtins := make(map[string]*object.Builtin, len(e.builtins))
+	for name, builtin := range e.builtins {
+		builtins[name] = builtin
+	}
+	return builtins
+}
+
+// defaultEvaluator backs the package-level Eval, SetOutput, SetMaxCallDepth,
+// and RegisterBuiltin.
+var defaultEvaluator = New(Options{})
+
+// Eval evaluates node with the package's default Evaluator.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return defaultEvaluator.Eval(node, env)
+}
+
+// SetOutput redirects the default Evaluator's output, e.g. to capture it in tests.
+func SetOutput(w io.Writer) {
+	defaultEvaluator.output = w
+}
+
+// RegisterBuiltin adds a builtin to the default Evaluator. See
+// Evaluator.RegisterBuiltin.
+func RegisterBuiltin(name string, fn object.BuiltInFunction) error {
+	return defaultEvaluator.RegisterBuiltin(name, fn)
+}
+
+// SetMaxCallDepth changes how deeply user functions may recurse under the
+// default Evaluator.
+func SetMaxCallDepth(depth int) {
+	defaultEvaluator.maxCallDepth = depth
+}
+
+const TAIL_CALL_OBJ = "TAIL_CALL"
+
+// tailCall is returned in place of a value when a function calls itself in
+// tail position. applyFunction reruns the function with the new arguments
+// instead of recursing, so deep tail recursion doesn't grow the Go stack.
+type tailCall struct {
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return TAIL_CALL_OBJ }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if e.maxOps > 0 {
+		if _, ok := node.(*ast.Program); ok {
+			e.ops = 0
+		}
+		e.ops++
+		if e.ops > e.maxOps {
+			return newError(object.LIMIT_ERROR, "operation limit exceeded")
+		}
+	}
+
+	result := e.evalNode(node, env)
+	if err, ok := result.(*object.Error); ok {
+		setErrorPosition(err, node)
+	}
+	return result
+}
+
+func (e *Evaluator) evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		// ?? short-circuits: the right side only runs when the left is null.
+		if node.Operator == "??" {
+			if left != NULL {
+				return left
+			}
+			return e.Eval(node.Right, env)
+		}
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return e.evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
+	case *ast.SwitchStatement:
+		return e.evalSwitchStatement(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+		val := e.Eval(node.ReturnValue, env)
+		if isError(val) || isTailCall(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		nameFunction(node.Value, val, node.Name.Value)
+		if result := env.Set(node.Name.Value, val); isError(result) {
+			return result
+		}
+	case *ast.DestructuringLetStatement:
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if result := destructure(node, val, env); isError(result) {
+			return result
+		}
+	case *ast.ConstStatement:
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		nameFunction(node.Value, val, node.Name.Value)
+		if result := env.SetConst(node.Name.Value, val); isError(result) {
+			return result
+		}
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		return &object.Function{
 			Environment: env,
 			Parameters:  node.Parameters,
+			Variadic:    node.Variadic,
 			Body:        node.Body,
 		}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if node.Tail && len(e.callStack) > 0 && function == e.callStack[len(e.callStack)-1] {
+			return &tailCall{args: args}
+		}
+		result := e.applyFunction(function, args)
+		if errObj, ok := result.(*object.Error); ok {
+			if fn, ok := function.(*object.Function); ok {
+				errObj.StackTrace = append(errObj.StackTrace, callFrame(node, fn))
+			}
+		}
+		return result
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		if node.Optional && left.Type() == object.NULL_OBJ {
+			return NULL
+		}
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return e.evalIndexExpression(left, index)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 	}
 
 	return nil
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 
-	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	for _, keyNode := range node.Order {
+		if spread, ok := keyNode.(*ast.SpreadExpression); ok {
+			evaluated := e.Eval(spread.Value, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			other, ok := evaluated.(*object.Hash)
+			if !ok {
+				return newError(object.TYPE_ERROR, "cannot spread %s, want HASH", evaluated.Type())
+			}
+			for _, pair := range other.OrderedPairs() {
+				hash.Set(pair.Key.(object.Hashable).HashKey(), pair)
+			}
+			continue
+		}
 
-		key := Eval(keyNode, env)
+		key := e.Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
 		hashable, ok := key.(object.Hashable)
 		if !ok {
-			return newError("hash key is not valid type. must be one of STRING, BOOLEAN, or INTEGER. got=%s", key.Type())
+			return newError(object.TYPE_ERROR, "hash key is not valid type. must be one of STRING, BOOLEAN, INTEGER, NULL, or FUNCTION. got=%s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.Eval(node.Pairs[keyNode], env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashable.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+	return hash
+
+}
+
+func (e *Evaluator) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if ident, ok := node.Target.(*ast.Identifier); ok {
+		value := e.Eval(node.Value, env)
 		if isError(value) {
 			return value
 		}
+		return env.Assign(ident.Value, value)
+	}
+	return e.evalIndexAssignment(node.Target.(*ast.IndexExpression), node.Value, env)
+}
+
+// evalIndexAssignment mutates the array or hash the target indexes into.
+// Nested targets like grid[1][2] work because indexing returns the inner
+// collection itself rather than a copy.
+func (e *Evaluator) evalIndexAssignment(target *ast.IndexExpression, valueNode ast.Expression, env *object.Environment) object.Object {
+	left := e.Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := e.Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+	value := e.Eval(valueNode, env)
+	if isError(value) {
+		return value
+	}
+	if reaches(value, left, map[object.Object]bool{}) {
+		return newError(object.VALUE_ERROR, "cannot store %s inside itself", left.Type())
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError(object.TYPE_ERROR, "array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError(object.INDEX_ERROR, "index out of range: %d (length %d)", idx.Value, len(left.Elements))
+		}
+		left.Elements[idx.Value] = value
+	case *object.Hash:
+		hashable, ok := index.(object.Hashable)
+		if !ok {
+			return newError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+		}
+		left.Set(hashable.HashKey(), object.HashPair{Key: index, Value: value})
+	default:
+		return newError(object.TYPE_ERROR, "index assignment not supported: %s", left.Type())
+	}
 
-		hashed := hashable.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+	return value
+}
 
+// reaches reports whether target is from, or is nested anywhere inside it.
+// Index assignment uses it to keep collections from containing themselves,
+// which would leave Inspect, equality, and clone with no bottom to reach.
+func reaches(from, target object.Object, visited map[object.Object]bool) bool {
+	if from == target {
+		return true
+	}
+	if visited[from] {
+		return false
 	}
-	return &object.Hash{Pairs: pairs}
 
+	switch from := from.(type) {
+	case *object.Array:
+		visited[from] = true
+		for _, el := range from.Elements {
+			if reaches(el, target, visited) {
+				return true
+			}
+		}
+	case *object.Hash:
+		visited[from] = true
+		for _, pair := range from.Pairs {
+			if reaches(pair.Value, target, visited) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func applyFunction(obj object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(obj object.Object, args []object.Object) object.Object {
 
 	switch fn := obj.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unWrapReturnValue(evaluated)
+		if len(e.callStack) >= e.maxCallDepth {
+			return newError(object.RECURSION_ERROR, "maximum recursion depth exceeded")
+		}
+		e.callStack = append(e.callStack, fn)
+		defer func() { e.callStack = e.callStack[:len(e.callStack)-1] }()
+
+		for {
+			if err := checkArity(fn, args); err != nil {
+				return err
+			}
+			extendedEnv, err := e.extendFunctionEnv(fn, args)
+			if err != nil {
+				return err
+			}
+			evaluated := e.Eval(fn.Body, extendedEnv)
+			if tc, ok := evaluated.(*tailCall); ok {
+				args = tc.args
+				continue
+			}
+			return unWrapReturnValue(evaluated)
+		}
 	case *object.Builtin:
 		return fn.Fn(args...)
 	default:
-		return newError("cannot call non-function object as a function: %s", obj.Type())
+		return newError(object.TYPE_ERROR, "cannot call non-function object as a function: %s", obj.Type())
+	}
+}
+
+// callFrame describes a call site for an error's stack trace. Functions are
+// named after the binding they were declared with, falling back to the name
+// they were called through.
+func callFrame(call *ast.CallExpression, fn *object.Function) string {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			name = ident.Value
+		}
+	}
+	return fmt.Sprintf("%s (line %d)", name, call.Token.Line)
+}
+
+// destructure binds each of node's names to the matching element or hash
+// value in val, failing without binding anything if val has the wrong shape.
+func destructure(node *ast.DestructuringLetStatement, val object.Object, env *object.Environment) object.Object {
+	values := make([]object.Object, len(node.Names))
+
+	if node.FromHash {
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError(object.TYPE_ERROR, "cannot destructure %s as HASH", val.Type())
+		}
+		for i, name := range node.Names {
+			key := &object.String{Value: name.Value}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				return newError(object.INDEX_ERROR, "cannot destructure missing key %q", name.Value)
+			}
+			values[i] = pair.Value
+		}
+	} else {
+		array, ok := val.(*object.Array)
+		if !ok {
+			return newError(object.TYPE_ERROR, "cannot destructure %s as ARRAY", val.Type())
+		}
+		if len(array.Elements) != len(node.Names) {
+			return newError(object.VALUE_ERROR, "cannot destructure %d elements into %d names", len(array.Elements), len(node.Names))
+		}
+		copy(values, array.Elements)
+	}
+
+	for i, name := range node.Names {
+		if result := env.Set(name.Value, values[i]); isError(result) {
+			return result
+		}
+	}
+	return nil
+}
+
+// nameFunction names a function created by a literal bound directly to name,
+// so `let f = fn() {}` is named f but `let g = f` leaves it alone.
+func nameFunction(node ast.Expression, val object.Object, name string) {
+	if _, ok := node.(*ast.FunctionLiteral); !ok {
+		return
+	}
+	if fn, ok := val.(*object.Function); ok {
+		fn.Name = name
+	}
+}
+
+// requiredParams counts the parameters a call must supply: those without a
+// default, not counting a rest parameter.
+func requiredParams(fn *object.Function) int {
+	required := 0
+	for i, param := range fn.Parameters {
+		if param.Default == nil && !(fn.Variadic && i == len(fn.Parameters)-1) {
+			required++
+		}
 	}
+	return required
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+func checkArity(fn *object.Function, args []object.Object) *object.Error {
+	required := requiredParams(fn)
+	if fn.Variadic {
+		if len(args) < required {
+			return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least %d", len(args), required)
+		}
+		return nil
+	}
+
+	if required == len(fn.Parameters) {
+		if len(args) != required {
+			return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=%d", len(args), required)
+		}
+		return nil
+	}
+
+	if len(args) < required {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least %d", len(args), required)
+	}
+	if len(args) > len(fn.Parameters) {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at most %d", len(args), len(fn.Parameters))
+	}
+	return nil
+}
+
+// extendFunctionEnv binds fn's parameters to args in a new environment.
+// Defaults for omitted parameters are evaluated there in order, so they see
+// the function's closure and any parameter declared before them.
+func (e *Evaluator) extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
 	env := object.NewEnclosedEnvironment(fn.Environment)
 
-	for idx, param := range fn.Parameters {
-		env.Set(param.Value, args[idx])
+	params := fn.Parameters
+	if fn.Variadic {
+		params = params[:len(params)-1]
+	}
+
+	for idx, param := range params {
+		if idx < len(args) {
+			env.Set(param.Value, args[idx])
+			continue
+		}
+		val := e.Eval(param.Default, env)
+		if isError(val) {
+			return nil, val
+		}
+		env.Set(param.Value, val)
+	}
+
+	if fn.Variadic {
+		rest := []object.Object{}
+		if len(args) > len(params) {
+			rest = append(rest, args[len(params):]...)
+		}
+		env.Set(fn.Parameters[len(params)].Value, &object.Array{Elements: rest})
 	}
 
-	return env
+	return env, nil
 }
 
 func unWrapReturnValue(obj object.Object) object.Object {
@@ -157,11 +639,24 @@ func unWrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	objects := []object.Object{}
 
 	for _, exp := range expressions {
-		evaluated := Eval(exp, env)
+		if spread, ok := exp.(*ast.SpreadExpression); ok {
+			evaluated := e.Eval(spread.Value, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				return []object.Object{newError(object.TYPE_ERROR, "cannot spread %s, want ARRAY", evaluated.Type())}
+			}
+			objects = append(objects, arr.Elements...)
+			continue
+		}
+
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -170,39 +665,46 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return objects
 }
 
-func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
+func (e *Evaluator) evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
 	if obj, ok := env.Get(ident.Value); ok {
 		return obj
 	}
 
-	if builtin, ok := builtins[ident.Value]; ok {
+	if builtin, ok := e.builtins[ident.Value]; ok {
 		return builtin
 	}
 
-	return newError("identifier not found: %s", ident.Value)
+	return newError(object.NAME_ERROR, "identifier not found: %s", ident.Value)
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+func (e *Evaluator) evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
+		return e.evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
 	}
 }
 
-func evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
+// evalHashIndexExpression falls back to the hash's __index__ function, if it
+// has one, for keys that aren't present.
+func (e *Evaluator) evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
 	hashKey, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
 	}
 
 	result, ok := hashObject.Pairs[hashKey.HashKey()]
 	if !ok {
+		if hook := operatorHook(hashObject, "__index__"); hook != nil {
+			return e.applyFunction(hook, []object.Object{index})
+		}
 		return NULL
 	}
 
@@ -221,16 +723,31 @@ func evalArrayIndexExpression(array object.Object, index object.Object) object.O
 	return arrayObject.Elements[idx]
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+// evalStringIndexExpression indexes by rune rather than by byte, so multibyte
+// characters come back whole. Out of range indices return NULL like arrays do.
+func evalStringIndexExpression(str object.Object, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	max := int64(len(runes) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
+			setErrorLine(result, statement)
 			return result
 		}
 	}
@@ -238,15 +755,21 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+// evalBlockStatement runs the block in its own scope, so lets inside it
+// don't leak out while outer bindings stay readable and assignable.
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, outer *object.Environment) object.Object {
 	var result object.Object
+	env := object.NewEnclosedEnvironment(outer)
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.ERROR_OBJ {
+				setErrorLine(result.(*object.Error), statement)
+			}
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == TAIL_CALL_OBJ {
 				return result
 			}
 		}
@@ -254,46 +777,247 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+// setErrorPosition records where err arose, unless a more deeply nested node
+// already has. It points at the operator that failed, or for calls at the
+// name of the function called, so errors raised inside a called function
+// keep their own position rather than the call site's.
+func setErrorPosition(err *object.Error, node ast.Node) {
+	if err.Line != 0 {
+		return
+	}
+
+	var tok token.Token
+	switch node := node.(type) {
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.PrefixExpression:
+		tok = node.Token
+	case *ast.InfixExpression:
+		tok = node.Token
+	case *ast.IndexExpression:
+		tok = node.Token
+	case *ast.AssignExpression:
+		tok = node.Token
+	case *ast.ArrayLiteral:
+		tok = node.Token
+	case *ast.HashLiteral:
+		tok = node.Token
+	case *ast.CallExpression:
+		tok = node.Token
+		if ident, ok := node.Function.(*ast.Identifier); ok {
+			tok = ident.Token
+		}
+	default:
+		return
+	}
+	err.Line, err.Column = tok.Line, tok.Column
+}
+
+// setErrorLine records the line of the statement err came from, unless a
+// more deeply nested statement already has.
+func setErrorLine(err *object.Error, stmt ast.Statement) {
+	if err.Line != 0 {
+		return
+	}
+
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		err.Line = stmt.Token.Line
+	case *ast.LetStatement:
+		err.Line = stmt.Token.Line
+	case *ast.ConstStatement:
+		err.Line = stmt.Token.Line
+	case *ast.DestructuringLetStatement:
+		err.Line = stmt.Token.Line
+	case *ast.ReturnStatement:
+		err.Line = stmt.Token.Line
+	case *ast.SwitchStatement:
+		err.Line = stmt.Token.Line
+	case *ast.BlockStatement:
+		err.Line = stmt.Token.Line
+	}
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
+	} else if ie.ElseIf != nil {
+		return e.evalIfExpression(ie.ElseIf, env)
 	}
 	return NULL
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
+// evalSwitchStatement runs the first case whose value equals the subject.
+// There is no fallthrough between cases.
+func (e *Evaluator) evalSwitchStatement(ss *ast.SwitchStatement, env *object.Environment) object.Object {
+	subject := e.Eval(ss.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, clause := range ss.Cases {
+		value := e.Eval(clause.Value, env)
+		if isError(value) {
+			return value
+		}
+		if objectsEqual(subject, value) {
+			return e.Eval(clause.Body, env)
+		}
+	}
+
+	if ss.Default != nil {
+		return e.Eval(ss.Default, env)
+	}
+	return NULL
+}
+
+// objectsEqual reports whether two values are structurally equal. Integers,
+// strings, and booleans compare by value, arrays element by element, and
+// hashes pair by pair regardless of order. Every null equals every other, so
+// values built by host builtins match the NULL singleton. Everything else,
+// including functions and builtins, compares by identity.
+func objectsEqual(left, right object.Object) bool {
+	if left == right {
+		return true
+	}
+	if left.Type() != right.Type() {
 		return false
-	case TRUE:
+	}
+
+	switch left := left.(type) {
+	case *object.Null:
+		return true
+	case *object.Boolean:
+		return left.Value == right.(*object.Boolean).Value
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Array:
+		r := right.(*object.Array)
+		if len(left.Elements) != len(r.Elements) {
+			return false
+		}
+		for i, el := range left.Elements {
+			if !objectsEqual(el, r.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		r := right.(*object.Hash)
+		if len(left.Pairs) != len(r.Pairs) {
+			return false
+		}
+		for key, pair := range left.Pairs {
+			other, ok := r.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
 		return true
-	case FALSE:
+	default:
+		return left == right
+	}
+}
+
+// evalTryExpression runs the handler in place of any error the block produces,
+// with the error message bound to the catch parameter as a string.
+func (e *Evaluator) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.Eval(te.Block, env)
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	handlerEnv.Set(te.Param.Value, &object.String{Value: errObj.Message})
+	if te.CodeParam != nil {
+		handlerEnv.Set(te.CodeParam.Value, &object.String{Value: errObj.Code})
+	}
+	return e.Eval(te.Handler, handlerEnv)
+}
+
+// isTruthy decides conditions. Only null and false are falsy; every other
+// value is truthy, including 0, "", [] and {}. It checks types rather than
+// the NULL, TRUE and FALSE singletons so that values built by host builtins
+// behave the same.
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Null:
 		return false
+	case *object.Boolean:
+		return obj.Value
 	default:
 		return true
 	}
 }
 
-func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+// operatorHooks names the hash keys under which a hash can store functions
+// that stand in for infix operators when it is the left operand. != is
+// answered by negating __eq__.
+var operatorHooks = map[string]string{
+	"+":  "__add__",
+	"==": "__eq__",
+	"!=": "__eq__",
+}
+
+// operatorHook returns the function stored under name in hash, or nil.
+func operatorHook(hash *object.Hash, name string) object.Object {
+	key := &object.String{Value: name}
+	pair, ok := hash.Pairs[key.HashKey()]
+	if !ok || !isCallable(pair.Value) {
+		return nil
+	}
+	return pair.Value
+}
+
+func (e *Evaluator) evalHookedInfixExpression(operator string, hook object.Object, right object.Object) object.Object {
+	result := e.applyFunction(hook, []object.Object{right})
+	if operator == "!=" && !isError(result) {
+		return nativeBoolToBooleanObject(!isTruthy(result))
+	}
+	return result
+}
+
+func (e *Evaluator) evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	if hash, ok := left.(*object.Hash); ok {
+		if name, ok := operatorHooks[operator]; ok {
+			if hook := operatorHook(hash, name); hook != nil {
+				return e.evalHookedInfixExpression(operator, hook, right)
+			}
+		}
+	}
+
+	// Equality is defined between any two values: different types are never
+	// equal, and same-typed values compare with objectsEqual.
 	switch {
+	case operator == "==":
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
+	case left.Type() == object.BOOLEAN_OBJ || right.Type() == object.BOOLEAN_OBJ:
+		// Booleans never stand in for 0 and 1; int(b) converts explicitly.
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return evalArrayInfixExpression(operator, left, right)
+	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ:
+		return evalHashInfixExpression(operator, left, right)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -301,24 +1025,88 @@ func evalStringInfixExpression(operator string, left object.Object, right object
 	l := left.(*object.String).Value
 	r := right.(*object.String).Value
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 
 	return &object.String{Value: l + r}
 }
 
+// evalArrayInfixExpression supports + for concatenation into a new array.
+func evalArrayInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	if operator != "+" {
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	l := left.(*object.Array).Elements
+	r := right.(*object.Array).Elements
+	elements := make([]object.Object, 0, len(l)+len(r))
+	elements = append(elements, l...)
+	elements = append(elements, r...)
+	return &object.Array{Elements: elements}
+}
+
+// evalHashInfixExpression supports + for merging into a new hash, like
+// {...left, ...right}: right's values win, and keys keep their first position.
+func evalHashInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	if operator != "+" {
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	merged := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	for _, hash := range []*object.Hash{left.(*object.Hash), right.(*object.Hash)} {
+		for _, pair := range hash.OrderedPairs() {
+			merged.Set(pair.Key.(object.Hashable).HashKey(), pair)
+		}
+	}
+	return merged
+}
+
 func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	l := left.(*object.Integer).Value
 	r := right.(*object.Integer).Value
 	switch operator {
 	case "+":
-		return &object.Integer{Value: l + r}
+		sum := l + r
+		if (l^sum)&(r^sum) < 0 {
+			return newError(object.VALUE_ERROR, "integer overflow")
+		}
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: l - r}
+		diff := l - r
+		if (l^r)&(l^diff) < 0 {
+			return newError(object.VALUE_ERROR, "integer overflow")
+		}
+		return &object.Integer{Value: diff}
 	case "*":
-		return &object.Integer{Value: l * r}
+		product := l * r
+		if l != 0 && (product/l != r || (l == -1 && r == math.MinInt64)) {
+			return newError(object.VALUE_ERROR, "integer overflow")
+		}
+		return &object.Integer{Value: product}
 	case "/":
+		// There is no float type, so division stays integral and truncates
+		// toward zero: 7 / 2 is 3 and -7 / 2 is -3.
+		if r == 0 {
+			return newError(object.VALUE_ERROR, "division by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return newError(object.VALUE_ERROR, "integer overflow")
+		}
 		return &object.Integer{Value: l / r}
+	case "&":
+		return &object.Integer{Value: l & r}
+	case "|":
+		return &object.Integer{Value: l | r}
+	case "^":
+		return &object.Integer{Value: l ^ r}
+	case "<<", ">>":
+		if r < 0 || r > 63 {
+			return newError(object.VALUE_ERROR, "invalid shift amount: %d", r)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: l << r}
+		}
+		return &object.Integer{Value: l >> r}
 	case "<":
 		return nativeBoolToBooleanObject(l < r)
 	case ">":
@@ -328,7 +1116,7 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	case "!=":
 		return nativeBoolToBooleanObject(l != r)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -338,31 +1126,38 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "+":
+		return evalPlusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	switch val := right.(type) {
 	case *object.Integer:
+		if val.Value == math.MinInt64 {
+			return newError(object.VALUE_ERROR, "integer overflow")
+		}
 		return &object.Integer{Value: -val.Value}
 	default:
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 }
 
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
+// evalPlusPrefixOperatorExpression returns integers unchanged and rejects
+// everything else, mirroring unary minus.
+func evalPlusPrefixOperatorExpression(right object.Object) object.Object {
+	if _, ok := right.(*object.Integer); !ok {
+		return newError(object.TYPE_ERROR, "unknown operator: +%s", right.Type())
 	}
+	return right
+}
+
+// evalBangOperatorExpression negates the operand's truthiness, so !x is
+// true only for null and false.
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -373,8 +1168,13 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(code string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Code: code}
+}
+
+func isTailCall(obj object.Object) bool {
+	_, ok := obj.(*tailCall)
+	return ok
 }
 
 func isError(obj object.Object) bool {
@@ -1,8 +1,15 @@
 package evaluator
 
 import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hudsn/learn-interpreter/ast"
 	"github.com/hudsn/learn-interpreter/lexer"
 	"github.com/hudsn/learn-interpreter/object"
 	"github.com/hudsn/learn-interpreter/parser"
@@ -41,6 +48,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{null: 5}[null]`,
+			5,
+		},
+		{
+			`let n = if (false) { 1 }; {null: 5}[n]`,
+			5,
+		},
+		{
+			`{0: 5}[null]`,
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -93,6 +112,135 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestFunctionHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn(x) { x }; let h = {f: 1}; h[f]`, 1},
+		{`let f = fn(x) { x }; let g = fn(x) { x }; let h = {f: 1}; h[g]`, nil},
+		{`let f = fn(x) { x }; let pass = fn(v) { v }; let h = {}; h[f] = 2; h[pass(f)]`, 2},
+		{`let make = fn() { fn() { 1 } }; let h = {make(): 1}; h[make()]`, nil},
+		{`let f = fn() { 1 }; let h = {f: 1}; h[f] = 3; len(h)`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiteralComputedKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"a" + "b": 1, 2 * 3: "x"}["ab"]`, 1},
+		{`{"a" + "b": 1, 2 * 3: "x"}[6]`, "x"},
+		{`let k = fn(x) { x + 1 }; {k(1): 10}[2]`, 10},
+		{`{1 < 2: 5}[true]`, 5},
+		{`{[1]: 1}`, errorMessage("hash key is not valid type. must be one of STRING, BOOLEAN, INTEGER, NULL, or FUNCTION. got=ARRAY")},
+		{`{1 + true: 1}`, errorMessage("unknown operator: INTEGER + BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = [1, 2, 3]; a[0] = 9; a[0]`, 9},
+		{`let a = [1, 2, 3]; a[2] = a[1] + 10; a[2]`, 12},
+		{`let a = [1, 2, 3]; a[1] = 5`, 5},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, 2},
+		{`let h = {}; h["b"] = 3; h["b"]`, 3},
+		{`let h = {}; h[1 + 1] = 4; h[2]`, 4},
+		{`let grid = [[1, 2, 3], [4, 5, 6]]; grid[1][2] = 0; grid[1][2]`, 0},
+		{`let h = {"xs": [1, 2]}; h["xs"][0] = 7; h["xs"][0]`, 7},
+		{`let a = [0]; let b = [0]; a[0] = b[0] = 8; a[0] + b[0]`, 16},
+		{`let a = [1]; let f = fn(arr) { arr[0] = 2 }; f(a); a[0]`, 2},
+		{`const a = [1]; a[0] = 3; a[0]`, 3},
+		{`let a = [1, 2]; a[2] = 3`, errorMessage("index out of range: 2 (length 2)")},
+		{`let a = [1, 2]; a[-1] = 3`, errorMessage("index out of range: -1 (length 2)")},
+		{`let a = [1, 2]; a["x"] = 3`, errorMessage("array index must be INTEGER, got STRING")},
+		{`let h = {}; h[[1]] = 3`, errorMessage("unusable as hash key: ARRAY")},
+		{`let s = "abc"; s[0] = "x"`, errorMessage("index assignment not supported: STRING")},
+		{`let a = [1]; a[0] = 1 + true`, errorMessage("unknown operator: INTEGER + BOOLEAN")},
+		{`let a = [1]; a[0] = a`, errorMessage("cannot store ARRAY inside itself")},
+		{`let h = {}; h["self"] = h`, errorMessage("cannot store HASH inside itself")},
+		{`let a = [1]; let b = [a]; a[0] = b`, errorMessage("cannot store ARRAY inside itself")},
+		{`let a = [1]; let h = {"xs": [a]}; a[0] = h`, errorMessage("cannot store ARRAY inside itself")},
+		{`let a = [1]; let b = [a, a]; b[0] = clone(b); len(b[0])`, 2},
+		{`let a = [1]; let b = [a]; b[0] = [a, a]; len(b[0])`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestOperatorHooks(t *testing.T) {
+	point := `let point = fn(x, y) {
+		let self = {"x": x, "y": y};
+		self["__add__"] = fn(other) { point(x + other["x"], y + other["y"]) };
+		self["__eq__"] = fn(other) { x == other["x"] };
+		self
+	};`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{point + `(point(1, 2) + point(3, 4))["x"]`, 4},
+		{point + `(point(1, 2) + point(3, 4))["y"]`, 6},
+		{point + `point(1, 2) == point(1, 5)`, true},
+		{point + `point(1, 2) == point(2, 2)`, false},
+		{point + `point(1, 2) != point(2, 2)`, true},
+		{point + `point(1, 2) != point(1, 2)`, false},
+		{`let h = {"__index__": fn(k) { k * 2 }, "a": 1}; h[21]`, 42},
+		{`let h = {"__index__": fn(k) { k * 2 }, "a": 1}; h["a"]`, 1},
+		{`let h = {"__add__": fn(v) { v + true }}; h + 1`, errorMessage("unknown operator: INTEGER + BOOLEAN")},
+		{`{"__add__": 1} + 1`, errorMessage("type mismatch: HASH + INTEGER")},
+		{`{"__add__": fn(v) { v }} - 1`, errorMessage("type mismatch: HASH - INTEGER")},
+		{`{"a": 1} - {"b": 2}`, errorMessage("unknown operator: HASH - HASH")},
+		{`{"__add__": fn(v) { 42 }} + {"b": 2}`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
 func TestArrayIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -151,6 +299,32 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[1]`, "e"},
+		{`"hello"[4]`, "o"},
+		{`let s = "héllo"; s[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-1]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := tt.expected.(string)
+		if ok {
+			testStringObject(t, evaluated, str)
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -170,6 +344,38 @@ func TestArrayLiterals(t *testing.T) {
 	testIntegerObject(t, result.Elements[2], 6)
 }
 
+func TestSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = [1, 2]; let b = [5]; [...a, 3, 4, ...b]`, "[1, 2, 3, 4, 5]"},
+		{`[...[], ...[]]`, "[]"},
+		{`let a = [1]; let b = [...a]; b[0] = 2; a`, "[1]"},
+		{`let h = {"a": 1, "b": 2}; let m = {...h, "b": 3}; [m["a"], m["b"]]`, "[1, 3]"},
+		{`let h = {"b": 2}; let m = {"b": 3, ...h}; m["b"]`, "2"},
+		{`let base = {"a": 1}; let extra = {"a": 2, "c": 3}; let m = {...base, ...extra}; [m["a"], m["c"], len(m)]`, "[2, 3, 2]"},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2], 3)`, "6"},
+		{`let count = fn(...xs) { len(xs) }; count(...[1, 2, 3], ...[4])`, "4"},
+		{`[...1]`, errorMessage("cannot spread INTEGER, want ARRAY")},
+		{`[...{"a": 1}]`, errorMessage("cannot spread HASH, want ARRAY")},
+		{`{...[1]}`, errorMessage("cannot spread ARRAY, want HASH")},
+		{`[...missing]`, errorMessage("identifier not found: missing")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -178,8 +384,40 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`len([])`, 0},
+		{`len([1, [2, 3]])`, 2},
+		{`len({})`, 0},
+		{`len({"a": 1, "b": 2, 3: [4]})`, 3},
+		{`len(1)`, "argument to `len` must be STRING, ARRAY, or HASH, got INTEGER"},
+		{`len(null)`, "argument to `len` must be STRING, ARRAY, or HASH, got NULL"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`abs(-5)`, 5},
+		{`abs(5)`, 5},
+		{`abs(-9223372036854775807)`, 9223372036854775807},
+		{`abs(-9223372036854775807 - 1)`, "integer overflow"},
+		{`abs("5")`, "argument to `abs` must be INTEGER, got STRING"},
+		{`min(3, 1, 2)`, 1},
+		{`max(3, 1, 2)`, 3},
+		{`max(-1, -7)`, -1},
+		{`min(1)`, "wrong number of arguments. got=1, want at least 2"},
+		{`max(1, true)`, "arguments to `max` must be INTEGER, got BOOLEAN"},
+		{`index([1, 2, 3], 2)`, 1},
+		{`index([1, 2, 3], 4)`, -1},
+		{`index([[1], "a", [1]], [1])`, 0},
+		{`index([], 1)`, -1},
+		{`index("hello", "ll")`, 2},
+		{`index("héllo", "l")`, 2},
+		{`index("hello", "")`, 0},
+		{`index("hello", "z")`, -1},
+		{`index("hello", 1)`, "second argument to `index` must be STRING when searching a STRING, got INTEGER"},
+		{`index(5, 1)`, "argument to `index` must be ARRAY or STRING, got INTEGER"},
+		{`floor(-2)`, -2},
+		{`ceil(3)`, 3},
+		{`round(0)`, 0},
+		{`round("1.5")`, "argument to `round` must be INTEGER, got STRING"},
+		{`floor(1, 2)`, "wrong number of arguments. got=2, want=1"},
 	}
 
 	for _, tt := range tests {
@@ -200,181 +438,2006 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
-func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
-	evaluated := testEval(input)
-	testStringObject(t, evaluated, "Hello World!")
-}
-
-func TestString(t *testing.T) {
-	input := `"hello world"`
+func TestEqualsBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`equals(1, 1)`, true},
+		{`equals(1, 2)`, false},
+		{`equals("a", "a")`, true},
+		{`equals(1, "1")`, false},
+		{`equals(null, null)`, true},
+		{`equals(true, true)`, true},
+		{`equals([1, [2, "x"]], [1, [2, "x"]])`, true},
+		{`equals([1, 2], [1, 2, 3])`, false},
+		{`equals([1, 2], [2, 1])`, false},
+		{`equals({"a": 1, "b": [2]}, {"b": [2], "a": 1})`, true},
+		{`equals({"a": 1}, {"a": 2})`, false},
+		{`equals({"a": 1}, {"b": 1})`, false},
+		{`equals({"a": {1: [true]}}, {"a": {1: [true]}})`, true},
+		{`equals([], {})`, false},
+		{`let f = fn(x) { x }; equals(f, f)`, true},
+		{`equals(fn(x) { x }, fn(x) { x })`, false},
+		{`equals(len, len)`, true},
+		{`let f = fn(x) { x }; let id = fn(g) { g }; equals(id(f), f) == (f == id(id(f)))`, true},
+		{`let make = fn() { fn() { 1 } }; equals(make(), make())`, false},
+	}
 
-	testStringObject(t, testEval(input), "hello world")
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
 
+	testErrorObject(t, testEval(`equals(1)`), "wrong number of arguments. got=1, want=2")
 }
 
-func testStringObject(t *testing.T, obj object.Object, expected string) bool {
-	strLit, ok := obj.(*object.String)
+func TestCloneBuiltin(t *testing.T) {
+	input := `let original = [1, [2, 3], {"a": [4]}]; [original, clone(original)]`
+
+	evaluated := testEval(input)
+	pair, ok := evaluated.(*object.Array)
 	if !ok {
-		t.Errorf("expected obj to be of type *object.String. got=%T", obj)
-		return false
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
-	if strLit.Value != expected {
-		t.Errorf("expected Value to be %q. got=%q", expected, strLit.Value)
-		return false
+	original := pair.Elements[0].(*object.Array)
+	copied, ok := pair.Elements[1].(*object.Array)
+	if !ok {
+		t.Fatalf("clone did not return Array. got=%T", pair.Elements[1])
 	}
-	return true
-}
 
-func TestClosures(t *testing.T) {
-	input := `
-		let newAdder = fn(x){
-			return fn(y) {return x + y;};
-		};
-		let addTwo = newAdder(2);
-		return addTwo(2);
-		`
+	if copied.Inspect() != original.Inspect() {
+		t.Errorf("clone has different contents. want=%s, got=%s", original.Inspect(), copied.Inspect())
+	}
+	if copied == original {
+		t.Errorf("clone returned the same array")
+	}
+	if copied.Elements[1] == original.Elements[1] {
+		t.Errorf("clone shares the nested array")
+	}
+	if copied.Elements[2] == original.Elements[2] {
+		t.Errorf("clone shares the nested hash")
+	}
 
-	testIntegerObject(t, testEval(input), 4)
-}
+	originalHash := original.Elements[2].(*object.Hash)
+	copiedHash := copied.Elements[2].(*object.Hash)
+	key := (&object.String{Value: "a"}).HashKey()
+	if copiedHash.Pairs[key].Value == originalHash.Pairs[key].Value {
+		t.Errorf("clone shares the array nested in a hash")
+	}
 
-func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected string
 	}{
-		{
-			"let f = fn(x){return x + 3;}; f(2);",
-			5,
-		},
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
+		{`clone([])`, "[]"},
+		{`clone({})`, "{}"},
+		{`clone(5)`, "5"},
+		{`clone("hi")`, "hi"},
 	}
-
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
 	}
-}
 
-func TestFunctionObject(t *testing.T) {
-	input := "fn(x) {x + 2;};"
-	evaluated := testEval(input)
-	fn, ok := evaluated.(*object.Function)
+	testBooleanObject(t, testEval(`let f = fn() { 1 }; equals(clone(f), f)`), true)
+	testIntegerObject(t, testEval(`let inner = [1]; let c = clone([inner, inner]); c[0][0] = 2; c[1][0]`), 2)
+
+	cyclic := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	cyclic.Elements = append(cyclic.Elements, cyclic)
+	self := &object.Hash{}
+	self.Set((&object.String{Value: "self"}).HashKey(), object.HashPair{Key: &object.String{Value: "self"}, Value: self})
+	cyclic.Elements = append(cyclic.Elements, self)
+
+	copied, ok = builtins["clone"].Fn(cyclic).(*object.Array)
 	if !ok {
-		t.Fatalf("object is not Function. got=%T %+v", evaluated, evaluated)
+		t.Fatalf("clone of a cyclic array did not return Array")
 	}
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
-	}
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
-	}
-	if len(fn.Body.Statements) != 1 {
-		t.Fatalf("function has wrong statements. Statements=%+v", fn.Body.Statements)
+	if copied == cyclic || copied.Elements[1] != copied {
+		t.Errorf("clone of a cyclic array does not refer to itself")
 	}
-	expectedBody := "(x + 2)"
-	if fn.Body.String() != expectedBody {
-		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	copiedSelf := copied.Elements[2].(*object.Hash)
+	if copiedSelf == self || copiedSelf.Pairs[(&object.String{Value: "self"}).HashKey()].Value != copiedSelf {
+		t.Errorf("clone of a cyclic hash does not refer to itself")
 	}
 }
 
-func TestLetStatements(t *testing.T) {
+func TestReverseBuiltin(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected interface{}
 	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{`reverse([1, 2, 3])`, []int64{3, 2, 1}},
+		{`reverse([])`, []int64{}},
+		{`let a = [1, 2]; reverse(a); a`, []int64{1, 2}},
+		{`reverse("abc")`, "cba"},
+		{`reverse("héllo")`, "olléh"},
+		{`reverse("")`, ""},
+		{`reverse(1)`, errorMessage("argument to `reverse` must be ARRAY or STRING, got INTEGER")},
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
 	}
 }
 
-func TestErrorHandling(t *testing.T) {
+func TestEntriesBuiltin(t *testing.T) {
 	tests := []struct {
-		input           string
-		expectedMessage string
+		input    string
+		expected interface{}
 	}{
-		{
-			"5 + true;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"-true",
-			"unknown operator: -BOOLEAN",
-		},
-		{
-			"true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`if (10 > 1) {
-				if (10 > 1) {
-					return true + false;
-				}
-				return 1;
-			}`,
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`"Hello" - "world"`,
-			"unknown operator: STRING - STRING",
-		},
-		{
-			"foobar",
-			"identifier not found: foobar",
-		},
-		{
-			`{"name": "Monkey"}[fn(x) { x }];`,
-			"unusable as hash key: FUNCTION",
-		},
+		{`entries({"b": 2, "a": 1, 3: "c"})`, "[[b, 2], [a, 1], [3, c]]"},
+		{`entries({})`, "[]"},
+		{`entries({"a": [1]})[0][1][0]`, "1"},
+		{`entries([1])`, errorMessage("argument to `entries` must be HASH, got ARRAY")},
+		{`entries()`, errorMessage("wrong number of arguments. got=0, want=1")},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		errObj, ok := evaluated.(*object.Error)
-		if !ok {
-			t.Errorf("no error object returned. got=%T %+v", evaluated, evaluated)
-			continue
-		}
-
-		if errObj.Message != tt.expectedMessage {
-			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
 		}
 	}
 }
 
-func TestReturnStatements(t *testing.T) {
+func TestHashInsertionOrder(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected interface{}
 	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{"if (10 > 1) { return 10; }", 10},
+		{`{"b": 2, "a": 1, 3: "c"}`, "{b: 2, a: 1, 3: c}"},
+		{`keys({"b": 2, "a": 1, 3: "c"})`, "[b, a, 3]"},
+		{`values({"b": 2, "a": 1, 3: "c"})`, "[2, 1, c]"},
+		{`keys({})`, "[]"},
+		{`let h = {"z": 1}; h["a"] = 2; h["m"] = 3; keys(h)`, "[z, a, m]"},
+		{`let h = {"z": 1, "a": 2}; h["z"] = 3; h`, "{z: 3, a: 2}"},
+		{`let base = {"x": 1, "y": 2}; {"w": 0, ...base, "x": 9}`, "{w: 0, x: 9, y: 2}"},
+		{`let h = {"b": [1], "a": 2}; clone(h)`, "{b: [1], a: 2}"},
+		{`keys([1])`, errorMessage("argument to `keys` must be HASH, got ARRAY")},
+		{`values()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("aaa", "a", "")`, ""},
+		{`replace("abc", "x", "y")`, "abc"},
+		{`replace("abc", "b")`, errorMessage("wrong number of arguments. got=2, want=3")},
+		{`replace("abc", 1, "y")`, errorMessage("arguments to `replace` must be STRING, got INTEGER")},
+		{`trim("  hi there \n\t")`, "hi there"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`trim("-=hi=-", "=-")`, "hi"},
+		{`trim("")`, ""},
+		{`trim(5)`, errorMessage("arguments to `trim` must be STRING, got INTEGER")},
+		{`trim()`, errorMessage("wrong number of arguments. got=0, want=1 or 2")},
+		{`upper("Hello, World")`, "HELLO, WORLD"},
+		{`upper("café ñ")`, "CAFÉ Ñ"},
+		{`lower("Hello, WORLD")`, "hello, world"},
+		{`lower("ÀÉÎ")`, "àéî"},
+		{`upper("")`, ""},
+		{`upper(1)`, errorMessage("argument to `upper` must be STRING, got INTEGER")},
+		{`lower([])`, errorMessage("argument to `lower` must be STRING, got ARRAY")},
+		{`lower()`, errorMessage("wrong number of arguments. got=0, want=1")},
+		{`let s = "héllo"; s[len(s) - 1]`, "o"},
+		{`let s = "日本語"; slice(s, len(s) - 1)`, "語"},
+		{`let s = "héllo"; slice(reverse(s), 0, len(s))`, "olléh"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestSplitAndJoinBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`split("a,b,c", ",")`, `[a, b, c]`},
+		{`split("a,,b", ",")`, `[a, , b]`},
+		{`len(split("", ","))`, `1`},
+		{`split("", ",")[0] == ""`, `true`},
+		{`split("héllo", "")`, `[h, é, l, l, o]`},
+		{`split("", "")`, `[]`},
+		{`join(["a", "b", "c"], "-")`, `a-b-c`},
+		{`join([], ",") == ""`, `true`},
+		{`join(["a"], ",")`, `a`},
+		{`join(split("a,b", ","), ",")`, `a,b`},
+		{`join(split("", ","), ",") == ""`, `true`},
+		{`split(1, ",")`, errorMessage("arguments to `split` must be STRING, got INTEGER")},
+		{`split("a")`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`join("a", ",")`, errorMessage("first argument to `join` must be ARRAY, got STRING")},
+		{`join(["a"], 1)`, errorMessage("second argument to `join` must be STRING, got INTEGER")},
+		{`join(["a", 1], ",")`, errorMessage("elements of the array passed to `join` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestLinesAndWordsBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`lines("a\nb\nc")`, `[a, b, c]`},
+		{`lines("a\nb\n")`, `[a, b]`},
+		{`lines("a\x0d\nb\x0d\n")`, `[a, b]`},
+		{`lines("a\n\nb")`, `[a, , b]`},
+		{`len(lines("\n"))`, `1`},
+		{`len(lines("a\n\n"))`, `2`},
+		{`lines("")`, `[]`},
+		{`lines("no newline")`, `[no newline]`},
+		{`words("  the quick\tbrown\n fox ")`, `[the, quick, brown, fox]`},
+		{`words("")`, `[]`},
+		{`words(" \n\t ")`, `[]`},
+		{`len(words(join(lines("a b\nc\n"), " ")))`, `3`},
+		{`lines(1)`, errorMessage("arguments to `lines` must be STRING, got INTEGER")},
+		{`words(["a"])`, errorMessage("arguments to `words` must be STRING, got ARRAY")},
+		{`words("a", "b")`, errorMessage("wrong number of arguments. got=2, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+// TestEmptyInputs checks that every string and array builtin accepts empty
+// strings and arrays and gives an empty result rather than null.
+func TestEmptyInputs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("")`, "0"},
+		{`len([])`, "0"},
+		{`replace("", "a", "b") == ""`, "true"},
+		{`replace("ab", "", "-")`, "-a-b-"},
+		{`trim("") == ""`, "true"},
+		{`trim("", "x") == ""`, "true"},
+		{`trim("ab", "")`, "ab"},
+		{`upper("") == ""`, "true"},
+		{`lower("") == ""`, "true"},
+		{`startswith("", "")`, "true"},
+		{`endswith("", "a")`, "false"},
+		{`contains("", "")`, "true"},
+		{`contains([], 1)`, "false"},
+		{`index("", "")`, "0"},
+		{`index("", "a")`, "-1"},
+		{`index([], 1)`, "-1"},
+		{`slice("", 0) == ""`, "true"},
+		{`slice([], 0)`, "[]"},
+		{`reverse("") == ""`, "true"},
+		{`reverse([])`, "[]"},
+		{`format("") == ""`, "true"},
+		{`format("{}", "") == ""`, "true"},
+		{`rest([])`, "[]"},
+		{`rest(rest([1]))`, "[]"},
+		{`push([], 1)`, "[1]"},
+		{`zip([], [])`, "[]"},
+		{`enumerate([])`, "[]"},
+		{`entries({})`, "[]"},
+		{`clone([])`, "[]"},
+		{`"" + "" == ""`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// errorMessage distinguishes an expected error from an expected string result.
+type errorMessage string
+
+func TestCharacterCodeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`ord("A")`, 65},
+		{`ord("é")`, 233},
+		{`ord("🐒")`, 128018},
+		{`chr(97)`, "a"},
+		{`chr(233)`, "é"},
+		{`chr(ord("a") + 1)`, "b"},
+		{`ord("")`, errorMessage("argument to `ord` must be a single character, got \"\"")},
+		{`ord("ab")`, errorMessage("argument to `ord` must be a single character, got \"ab\"")},
+		{`ord(1)`, errorMessage("argument to `ord` must be STRING, got INTEGER")},
+		{`chr(-1)`, errorMessage("invalid code point for `chr`: -1")},
+		{`chr(1114112)`, errorMessage("invalid code point for `chr`: 1114112")},
+		{`chr(55296)`, errorMessage("invalid code point for `chr`: 55296")},
+		{`chr("a")`, errorMessage("argument to `chr` must be INTEGER, got STRING")},
+		{`chr()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestAssertBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`assert(true)`, nil},
+		{`assert(1 < 2, "math works")`, nil},
+		{`assert(0)`, nil},
+		{`assert(false)`, errorMessage("assertion failed")},
+		{`assert(null)`, errorMessage("assertion failed")},
+		{`assert(1 > 2, "one is not bigger than two")`, errorMessage("one is not bigger than two")},
+		{`assert(false, "100%")`, errorMessage("100%")},
+		{`assert(false, "stop"); 5`, errorMessage("stop")},
+		{`assert(true, 1)`, errorMessage("second argument to `assert` must be STRING, got INTEGER")},
+		{`assert()`, errorMessage("wrong number of arguments. got=0, want=1 or 2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestZipAndEnumerateBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`zip([1, 2, 3], ["a", "b", "c"])`, `[[1, a], [2, b], [3, c]]`},
+		{`zip([1, 2, 3], [4])`, `[[1, 4]]`},
+		{`zip([], [1, 2])`, `[]`},
+		{`enumerate(["a", "b"])`, `[[0, a], [1, b]]`},
+		{`enumerate([])`, `[]`},
+		{`zip([1], 2)`, errorMessage("arguments to `zip` must be ARRAY, got INTEGER")},
+		{`zip([1])`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`enumerate("ab")`, errorMessage("argument to `enumerate` must be ARRAY, got STRING")},
+		{`enumerate()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFunctionIntrospectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`arity(fn() {})`, 0},
+		{`arity(fn(a, b) { a + b })`, 2},
+		{`arity(fn(a, ...rest) { a })`, -1},
+		{`arity(len)`, -1},
+		{`params(fn(a, b) { a + b })`, `[a, b]`},
+		{`params(fn(a, ...rest) { a })`, `[a, ...rest]`},
+		{`params(fn() {})`, `[]`},
+		{`arity(1)`, errorMessage("argument to `arity` must be FUNCTION, got INTEGER")},
+		{`params(len)`, errorMessage("argument to `params` must be FUNCTION, got BUILTIN")},
+		{`arity()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestPartialBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let add = fn(a, b) { a + b }; let inc = partial(add, 1); inc(41)`, 42},
+		{`let add = fn(a, b) { a + b }; partial(add, 1, 2)()`, 3},
+		{`let add = fn(a, b) { a + b }; partial(add)(1, 2)`, 3},
+		{`let sum = fn(...xs) { len(xs) }; partial(sum, 1, 2, 3)(4)`, 4},
+		{`partial(partial(fn(a, b, c) { a * b + c }, 2), 3)(4)`, 10},
+		{`partial(max, 5)(3, 9)`, 9},
+		{`partial(fn(a) { a }, 1, 2)`, errorMessage("too many arguments to `partial`. got=2, want at most 1")},
+		{`partial(fn(a, b) { a }, 1)(2, 3)`, errorMessage("wrong number of arguments. got=3, want=2")},
+		{`partial(1)`, errorMessage("first argument to `partial` must be FUNCTION, got INTEGER")},
+		{`partial()`, errorMessage("wrong number of arguments. got=0, want at least 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestComposeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(inc, dbl)(5)`, 11},
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(dbl, inc)(5)`, 12},
+		{`compose(fn(x) { x + 1 }, fn(x) { x * 2 }, fn(a, b) { a - b })(10, 3)`, 15},
+		{`compose(len, rest)([1, 2, 3])`, 2},
+		{`compose(fn(...xs) { len(xs) }, fn(x) { x })(1)`, 1},
+		{`compose(fn(x) { x }, fn(x) { missing })(1)`, errorMessage("identifier not found: missing")},
+		{`compose(fn(a, b) { a }, fn(x) { x })`, errorMessage("argument 1 to `compose` must take exactly one argument, got fn(a, b)")},
+		{`compose(fn(x) { x }, 1)`, errorMessage("arguments to `compose` must be FUNCTION, got INTEGER")},
+		{`compose(fn(x) { x })`, errorMessage("wrong number of arguments. got=1, want at least 2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestIntBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`int("42")`, 42},
+		{`int("-17")`, -17},
+		{`int("+5")`, 5},
+		{`int("  42  ")`, 42},
+		{`int("\t7\n")`, 7},
+		{`int("0xff")`, 255},
+		{`int("0b101")`, 5},
+		{`int("1_000")`, 1000},
+		{`int("9223372036854775807")`, 9223372036854775807},
+		{`int(3)`, 3},
+		{`int("")`, errorMessage(`cannot parse "" as INTEGER`)},
+		{`int("abc")`, errorMessage(`cannot parse "abc" as INTEGER`)},
+		{`int("1.5")`, errorMessage(`cannot parse "1.5" as INTEGER`)},
+		{`int("1e3")`, errorMessage(`cannot parse "1e3" as INTEGER`)},
+		{`int("4 2")`, errorMessage(`cannot parse "4 2" as INTEGER`)},
+		{`int("9223372036854775808")`, errorMessage(`integer out of range: "9223372036854775808"`)},
+		{`int(true)`, 1},
+		{`int(false)`, 0},
+		{`int(1 > 2) + 1`, 1},
+		{`int(null)`, errorMessage("argument to `int` must be STRING, INTEGER, or BOOLEAN, got NULL")},
+		{`int()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestMemoizeBuiltin(t *testing.T) {
+	fib := `let calls = 0;
+let fib = %s(fn(n) {
+	calls = calls + 1;
+	if (n < 2) { n } else { fib(n - 1) + fib(n - 2) }
+});
+[fib(20), calls]`
+
+	plain := testEval(strings.Replace(fib, "%s", "", 1))
+	memoized := testEval(strings.Replace(fib, "%s", "memoize", 1))
+	if plain.Inspect() != "[6765, 21891]" {
+		t.Errorf("wrong unmemoized result. got=%s", plain.Inspect())
+	}
+	if memoized.Inspect() != "[6765, 21]" {
+		t.Errorf("wrong memoized result. got=%s", memoized.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let n = 0; let f = memoize(fn(a, b) { n = n + 1; a + b }); f(1, 2); f(1, 2); f(2, 1); n`, 2},
+		{`let n = 0; let f = memoize(fn(xs) { n = n + 1; len(xs) }); f([1]); f([1]); n`, 2},
+		{`let n = 0; let f = memoize(fn(x) { n = n + 1; x }); f("1"); f(1); n`, 2},
+		{`let n = 0; let f = memoize(fn(x) { n = n + 1; x / 0 }); try { f(1) } catch (e) { 0 }; try { f(1) } catch (e) { 0 }; n`, 2},
+		{`memoize(len)("abc")`, 3},
+		{`memoize(1)`, errorMessage("argument to `memoize` must be FUNCTION, got INTEGER")},
+		{`memoize()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestIntegerMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`gcd(12, 18)`, 6},
+		{`gcd(-12, 18)`, 6},
+		{`gcd(12, -18)`, 6},
+		{`gcd(7, 0)`, 7},
+		{`gcd(0, 0)`, 0},
+		{`gcd(17, 5)`, 1},
+		{`gcd(-9223372036854775807 - 1, 6)`, 2},
+		{`gcd(-9223372036854775807 - 1, 0)`, errorMessage("integer overflow")},
+		{`lcm(4, 6)`, 12},
+		{`lcm(-4, 6)`, 12},
+		{`lcm(0, 6)`, 0},
+		{`lcm(9223372036854775807, 2)`, errorMessage("integer overflow")},
+		{`pow(2, 10)`, 1024},
+		{`pow(-3, 3)`, -27},
+		{`pow(5, 0)`, 1},
+		{`pow(0, 0)`, 1},
+		{`pow(2, 62)`, 4611686018427387904},
+		{`pow(-2, 63)`, -9223372036854775807 - 1},
+		{`pow(2, 63)`, errorMessage("integer overflow")},
+		{`pow(10, 1000000000000)`, errorMessage("integer overflow")},
+		{`pow(1, 1000000000000)`, 1},
+		{`pow(4, 13, 497)`, 445},
+		{`pow(-4, 3, 7)`, 6},
+		{`pow(9223372036854775807, 9223372036854775807, 1000000007)`, 856225998},
+		{`pow(2, -1)`, errorMessage("second argument to `pow` must not be negative, got -1")},
+		{`pow(2, 3, 0)`, errorMessage("third argument to `pow` must be positive, got 0")},
+		{`pow(2, "3")`, errorMessage("arguments to `pow` must be INTEGER, got STRING")},
+		{`pow(2)`, errorMessage("wrong number of arguments. got=1, want=2 or 3")},
+		{`gcd(1, true)`, errorMessage("arguments to `gcd` must be INTEGER, got BOOLEAN")},
+		{`lcm(1)`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestArrayAndHashConstructors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`array(3)`, "[null, null, null]"},
+		{`array(0)`, "[]"},
+		{`array(2, 7)`, "[7, 7]"},
+		{`array(2, "ab")`, "[ab, ab]"},
+		{`let grid = array(2, array(2, 0)); grid[0][1] = 5; grid`, "[[0, 5], [0, 0]]"},
+		{`let row = [1]; let rows = array(2, row); rows[0][0] = 9; [row, rows]`, "[[1], [[9], [1]]]"},
+		{`hash()`, "{}"},
+		{`let h = hash(); h["a"] = 1; h["b"] = hash(); h["b"]["c"] = 2; h`, "{a: 1, b: {c: 2}}"},
+		{`let a = hash(); let b = hash(); a["x"] = 1; b`, "{}"},
+		{`let counts = hash(); times(3, fn(i) { counts[i] = array(i) }); counts`, "{0: [], 1: [null], 2: [null, null]}"},
+		{`array(-1)`, errorMessage("first argument to `array` must not be negative, got -1")},
+		{`array(1000000000000)`, errorMessage("first argument to `array` must be at most 16777216, got 1000000000000")},
+		{`len(array(16777216))`, "16777216"},
+		{`array("3")`, errorMessage("first argument to `array` must be INTEGER, got STRING")},
+		{`array()`, errorMessage("wrong number of arguments. got=0, want=1 or 2")},
+		{`hash(1)`, errorMessage("wrong number of arguments. got=1, want=0")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, evaluated.Inspect(), expected)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestTakeAndDropBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`take([1, 2, 3], 2)`, "[1, 2]"},
+		{`take([1, 2, 3], 0)`, "[]"},
+		{`take([1, 2, 3], 5)`, "[1, 2, 3]"},
+		{`take([1, 2, 3], -2)`, "[2, 3]"},
+		{`take([1, 2, 3], -5)`, "[1, 2, 3]"},
+		{`take([], 2)`, "[]"},
+		{`drop([1, 2, 3], 1)`, "[2, 3]"},
+		{`drop([1, 2, 3], 0)`, "[1, 2, 3]"},
+		{`drop([1, 2, 3], 5)`, "[]"},
+		{`drop([1, 2, 3], -1)`, "[1, 2]"},
+		{`drop([1, 2, 3], -5)`, "[]"},
+		{`drop([], -1)`, "[]"},
+		{`let a = [1, 2, 3]; let b = take(a, 2); b[0] = 9; [a, b]`, "[[1, 2, 3], [9, 2]]"},
+		{`let a = [1, 2, 3]; let b = drop(a, 1); b[0] = 9; [a, b]`, "[[1, 2, 3], [9, 3]]"},
+		{`take(map(drop([1, 2, 3, 4], 1), fn(x) { x * 10 }), 2)`, "[20, 30]"},
+		{`take("abc", 1)`, errorMessage("first argument to `take` must be ARRAY, got STRING")},
+		{`drop([1], "1")`, errorMessage("second argument to `drop` must be INTEGER, got STRING")},
+		{`take([1])`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, evaluated.Inspect(), expected)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFlattenBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`flatten([])`, "[]"},
+		{`flatten([1, 2])`, "[1, 2]"},
+		{`flatten([[1], [], [2, 3], 4, [5, [6]]])`, "[1, 2, 3, 4, 5, [6]]"},
+		{`flatten([[1, [2, [3, [4]]]]], 2)`, "[1, 2, [3, [4]]]"},
+		{`flatten([[1, [2, [3, [4]]]]], -1)`, "[1, 2, 3, 4]"},
+		{`flatten([[[[]]], "a", [null, {"k": [1]}]], -1)`, "[a, null, {k: [1]}]"},
+		{`flatten([[1]], 0)`, "[[1]]"},
+		{`let a = [[1]]; let b = flatten(a, 0); b[0] = 2; a`, "[[1]]"},
+		{`flatten(1)`, errorMessage("first argument to `flatten` must be ARRAY, got INTEGER")},
+		{`flatten([], "1")`, errorMessage("second argument to `flatten` must be INTEGER, got STRING")},
+		{`flatten([], -2)`, errorMessage("second argument to `flatten` must be -1 or more, got -2")},
+		{`flatten()`, errorMessage("wrong number of arguments. got=0, want=1 or 2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, evaluated.Inspect(), expected)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestMapAndFilterBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`filter([1, null, false, 0], fn(x) { x })`, "[1, 0]"},
+		// The callback closes over variables from where it was defined, not
+		// from inside the builtin.
+		{`let scale = 10; let f = fn(x) { x * scale }; map([1, 2], f)`, "[10, 20]"},
+		{`let makeScaler = fn(factor) { fn(x) { x * factor } }; let x = 100; map([1, 2], makeScaler(3))`, "[3, 6]"},
+		{`let min = 2; let above = fn(x) { x > min }; let g = fn(min) { filter([1, 2, 3], above) }; g(0)`, "[3]"},
+		{`map([1, 0], fn(x) { 1 / x })`, errorMessage("division by zero")},
+		{`map(1, fn(x) { x })`, errorMessage("first argument to `map` must be ARRAY, got INTEGER")},
+		{`filter([1], 1)`, errorMessage("second argument to `filter` must be FUNCTION, got INTEGER")},
+		{`map([1])`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, evaluated.Inspect(), expected)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestBoolBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`bool(true)`, true},
+		{`bool(false)`, false},
+		{`bool(null)`, false},
+		{`bool(1)`, true},
+		{`bool(0)`, true},
+		{`bool(-1)`, true},
+		{`bool("")`, true},
+		{`bool("a")`, true},
+		{`bool([])`, true},
+		{`bool({})`, true},
+		{`bool(fn() {})`, true},
+		{`bool(puts)`, true},
+		{`bool(1 > 2)`, false},
+		{`bool()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFormatBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`format("plain")`, "plain"},
+		{`format("{} + {} = {}", 1, 2, 1 + 2)`, "1 + 2 = 3"},
+		{`format("hi {}!", "bob")`, "hi bob!"},
+		{`format("{}", [1, "a"])`, "[1, a]"},
+		{`format("{{}} is {}", null)`, "{} is null"},
+		{`format("{{{}}}", 5)`, "{5}"},
+		{`format("héllo {}", "wörld")`, "héllo wörld"},
+		{`format("{} {}", 1)`, errorMessage("`format` template has 2 placeholders, got 1 arguments")},
+		{`format("{}", 1, 2)`, errorMessage("`format` template has 1 placeholders, got 2 arguments")},
+		{`format("a { b", 1)`, errorMessage("unmatched '{' in `format` template")},
+		{`format("a } b")`, errorMessage("unmatched '}' in `format` template")},
+		{`format(1)`, errorMessage("first argument to `format` must be STRING, got INTEGER")},
+		{`format()`, errorMessage("wrong number of arguments. got=0, want at least 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestSliceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`slice([1, 2, 3, 4], 1, 3)`, []int64{2, 3}},
+		{`slice([1, 2, 3, 4], 2)`, []int64{3, 4}},
+		{`slice([1, 2, 3, 4], 1, null)`, []int64{2, 3, 4}},
+		{`slice([1, 2, 3, 4], -2)`, []int64{3, 4}},
+		{`slice([1, 2, 3, 4], 0, -1)`, []int64{1, 2, 3}},
+		{`slice([1, 2, 3, 4], 2, 2)`, []int64{}},
+		{`slice([], 0)`, []int64{}},
+		{`slice("héllo", 1, 4)`, "éll"},
+		{`slice("héllo", -2)`, "lo"},
+		{`slice([1, 2], 0, 3)`, errorMessage("slice bounds out of range [0:3] with length 2")},
+		{`slice([1, 2], 2, 1)`, errorMessage("slice bounds out of range [2:1] with length 2")},
+		{`slice([1, 2], -3)`, errorMessage("slice bounds out of range [-1:2] with length 2")},
+		{`slice([1, 2], "a")`, errorMessage("bounds for `slice` must be INTEGER, got STRING")},
+		{`slice([1, 2], null)`, errorMessage("bounds for `slice` must be INTEGER, got NULL")},
+		{`slice(1, 0)`, errorMessage("first argument to `slice` must be ARRAY or STRING, got INTEGER")},
+		{`slice([1])`, errorMessage("wrong number of arguments. got=1, want=2 or 3")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestStringPredicateBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`startswith("monkey", "mon")`, true},
+		{`startswith("monkey", "key")`, false},
+		{`startswith("monkey", "")`, true},
+		{`endswith("monkey", "key")`, true},
+		{`endswith("monkey", "mon")`, false},
+		{`contains("monkey", "nke")`, true},
+		{`contains("monkey", "xyz")`, false},
+		{`contains("héllo", "é")`, true},
+		{`contains([1, [2], "a"], [2])`, true},
+		{`contains([1, 2], "1")`, false},
+		{`startswith("a", 1)`, errorMessage("arguments to `startswith` must be STRING, got INTEGER")},
+		{`endswith(1, "a")`, errorMessage("arguments to `endswith` must be STRING, got INTEGER")},
+		{`contains("a", 1)`, errorMessage("arguments to `contains` must be STRING, got INTEGER")},
+		{`contains(1, 1)`, errorMessage("first argument to `contains` must be STRING or ARRAY, got INTEGER")},
+		{`startswith("a")`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestCountBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`count("banana", "a")`, 3},
+		{`count("banana", "an")`, 2},
+		{`count("aaaa", "aa")`, 2},
+		{`count("héllo", "l")`, 2},
+		{`count("abc", "")`, 4},
+		{`count("", "a")`, 0},
+		{`count([1, 2, 1, 1], 1)`, 3},
+		{`count([[1], [1], 2], [1])`, 2},
+		{`count([1, 2], "1")`, 0},
+		{`count([], 1)`, 0},
+		{`count("a", 1)`, errorMessage("second argument to `count` must be STRING when counting in a STRING, got INTEGER")},
+		{`count(1, 1)`, errorMessage("first argument to `count` must be STRING or ARRAY, got INTEGER")},
+		{`count([1])`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestRangeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`range(4)`, []int64{0, 1, 2, 3}},
+		{`range(2, 5)`, []int64{2, 3, 4}},
+		{`range(0, 10, 3)`, []int64{0, 3, 6, 9}},
+		{`range(5, 0, -2)`, []int64{5, 3, 1}},
+		{`range(0)`, []int64{}},
+		{`range(5, 2)`, []int64{}},
+		{`range(2, 5, -1)`, []int64{}},
+		{`range(9223372036854775806, 9223372036854775807, 2)`, []int64{9223372036854775806}},
+		{`range(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807)`, []int64{-9223372036854775808, -1, 9223372036854775806}},
+		{`range(9223372036854775807, -9223372036854775807 - 1, -9223372036854775807 - 1)`, []int64{9223372036854775807, -1}},
+		{`range(1, 5, 0)`, "`range` step must not be zero"},
+		{`range(9223372036854775807)`, "`range` would produce 9223372036854775807 elements, more than the limit of 16777216"},
+		{`range(-9223372036854775807 - 1, 9223372036854775807)`, "`range` would produce 18446744073709551615 elements, more than the limit of 16777216"},
+		{`range("a")`, "arguments to `range` must be INTEGER, got STRING"},
+		{`range()`, "wrong number of arguments. got=0, want=1 to 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTimesBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`times(0, fn(i) { i })`, nil},
+		{`times(3, fn(i) { i })`, nil},
+		{`times(3, fn(i) { if (i == 1) { i + true } })`, "unknown operator: INTEGER + BOOLEAN"},
+		{`times(-1, fn(i) { i })`, "first argument to `times` must not be negative, got -1"},
+		{`times("3", fn(i) { i })`, "first argument to `times` must be INTEGER, got STRING"},
+		{`times(3, 3)`, "second argument to `times` must be FUNCTION, got INTEGER"},
+		{`times(3)`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestTimesPassesIndex(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stdout)
+
+	testEval(`times(3, fn(i) { puts(i * 10) }); times(2, puts)`)
+
+	expected := "0\n10\n20\n0\n1\n"
+	if buf.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, buf.String())
+	}
+}
+
+func TestIteratorBuiltins(t *testing.T) {
+	counter := `let count = 0;
+	let it = iter(fn() { if (count < 3) { count = count + 1; count } else { null } });`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{counter + `next(it)`, 1},
+		{counter + `next(it); next(it); next(it)`, 3},
+		{counter + `next(it); next(it); next(it); next(it)`, nil},
+		{counter + `next(it); next(it); next(it); next(it); count = 0; next(it)`, nil},
+		{counter + `let total = 0; times(5, fn(i) { let v = next(it); if (v) { total = total + v } }); total`, 6},
+		{`let it = iter(fn() { 1 + true }); next(it)`, errorMessage("unknown operator: INTEGER + BOOLEAN")},
+		{`iter(fn(x) { x })`, errorMessage("argument to `iter` must take no arguments, got 1")},
+		{`iter(1)`, errorMessage("argument to `iter` must be FUNCTION, got INTEGER")},
+		{`next([1])`, errorMessage("argument to `next` must be ITERATOR, got ARRAY")},
+		{`next()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+
+	return true
+}
+
+func testIntegerArray(t *testing.T, obj object.Object, expected []int64) bool {
+	array, ok := obj.(*object.Array)
+	if !ok {
+		t.Errorf("obj is not Array. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if len(array.Elements) != len(expected) {
+		t.Errorf("array has wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		return false
+	}
+
+	for i, value := range expected {
+		if !testIntegerObject(t, array.Elements[i], value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestPutsWritesToOutput(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stdout)
+
+	evaluated := testEval(`puts("hello", 1 + 2, [1]); puts()`)
+	testNullObject(t, evaluated)
+
+	expected := "hello\n3\n[1]\n"
+	if buf.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, buf.String())
+	}
+}
+
+func TestEvaluatorOptions(t *testing.T) {
+	var first, second bytes.Buffer
+	shout := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return &object.String{Value: "!"}
+	}}
+	a := New(Options{Output: &first, MaxCallDepth: 5, Builtins: map[string]*object.Builtin{"shout": shout}})
+	b := New(Options{Output: &second})
+
+	program := func(input string) *ast.Program {
+		return parser.New(lexer.New(input)).ParseProgram()
+	}
+
+	a.Eval(program(`puts("a")`), object.NewEnvironment())
+	b.Eval(program(`puts("b")`), object.NewEnvironment())
+	if first.String() != "a\n" || second.String() != "b\n" {
+		t.Errorf("output mixed between evaluators. first=%q, second=%q", first.String(), second.String())
+	}
+
+	deep := program(`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10)`)
+	testErrorObject(t, a.Eval(deep, object.NewEnvironment()), "maximum recursion depth exceeded")
+	testIntegerObject(t, b.Eval(deep, object.NewEnvironment()), 10)
+
+	testStringObject(t, a.Eval(program(`shout()`), object.NewEnvironment()), "!")
+	testErrorObject(t, b.Eval(program(`shout()`), object.NewEnvironment()), "identifier not found: shout")
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	ev := New(Options{})
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+
+	if err := ev.RegisterBuiltin("double", double); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	if err := ev.RegisterBuiltin("double", double); err == nil {
+		t.Errorf("expected error registering double twice")
+	}
+	if err := ev.RegisterBuiltin("puts", double); err == nil {
+		t.Errorf("expected error registering over puts")
+	}
+
+	program := parser.New(lexer.New(`double(21)`)).ParseProgram()
+	testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), 42)
+	testErrorObject(t, testEval(`double(21)`), "identifier not found: double")
+}
+
+func TestBuiltinsHaveDocs(t *testing.T) {
+	ev := New(Options{AllowIO: true})
+	builtins := ev.Builtins()
+	if _, ok := builtins["len"]; !ok {
+		t.Fatalf("Builtins() is missing len")
+	}
+	for name, builtin := range builtins {
+		if builtin.Doc == "" {
+			t.Errorf("builtin %q has no Doc", name)
+		}
+	}
+
+	delete(builtins, "len")
+	if _, ok := ev.Builtins()["len"]; !ok {
+		t.Errorf("changing the map returned by Builtins() changed the Evaluator")
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	if err := os.WriteFile(dir+"/in.txt", []byte("héllo\nworld\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`read_file("DIR/in.txt")`, "héllo\nworld\n"},
+		{`lines(read_file("DIR/in.txt"))[1]`, "world"},
+		{`write_file("DIR/out.txt", "a\nb")`, nil},
+		{`write_file("DIR/out.txt", "first"); write_file("DIR/out.txt", "second"); read_file("DIR/out.txt")`, "second"},
+		{`write_file("DIR/empty.txt", ""); read_file("DIR/empty.txt")`, ""},
+		{`try { read_file("DIR/missing.txt") } catch (e, code) { code }`, "IO_ERROR"},
+		{`try { write_file("DIR/no/such/dir.txt", "x") } catch (e, code) { code }`, "IO_ERROR"},
+		{`read_file(1)`, errorMessage("arguments to `read_file` must be STRING, got INTEGER")},
+		{`write_file("DIR/x.txt", 1)`, errorMessage("arguments to `write_file` must be STRING, got INTEGER")},
+		{`write_file("DIR/x.txt")`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	ev := New(Options{AllowIO: true})
+	for _, tt := range tests {
+		program := parser.New(lexer.New(strings.ReplaceAll(tt.input, "DIR", dir))).ParseProgram()
+		evaluated := ev.Eval(program, object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	written, err := os.ReadFile(dir + "/out.txt")
+	if err != nil || string(written) != "second" {
+		t.Errorf("write_file wrote %q, %v", written, err)
+	}
+}
+
+func TestInputBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected string
+		output   string
+	}{
+		{`input()`, "hello\nworld\n", "hello", ""},
+		{`input("name? ")`, "Ann\n", "Ann", "name? "},
+		{`[input(), input(), input()]`, "a\r\n\nb", "[a, , b]", ""},
+		{`[input(), input()]`, "last", "[last, null]", ""},
+		{`input("> ")`, "", "null", "> "},
+		{`input(1)`, "", "ERROR: argument to `input` must be STRING, got INTEGER", ""},
+		{`input("a", "b")`, "", "ERROR: wrong number of arguments. got=2, want=0 or 1", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		ev := New(Options{Output: &out, Input: strings.NewReader(tt.stdin)})
+		evaluated := ev.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+func TestFileBuiltinsNeedAllowIO(t *testing.T) {
+	evaluated := testEval(`read_file("x")`)
+	testErrorObject(t, evaluated, "identifier not found: read_file")
+
+	if _, ok := New(Options{}).Builtins()["write_file"]; ok {
+		t.Errorf("write_file is available without AllowIO")
+	}
+}
+
+func TestRandomBuiltin(t *testing.T) {
+	program := parser.New(lexer.New(`[random(10), random(10), random(1000), random(1)]`)).ParseProgram()
+
+	first := New(Options{Random: rand.New(rand.NewSource(42))}).Eval(program, object.NewEnvironment())
+	second := New(Options{Random: rand.New(rand.NewSource(42))}).Eval(program, object.NewEnvironment())
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("same seed gave different results: %s and %s", first.Inspect(), second.Inspect())
+	}
+
+	bounds := []int64{10, 10, 1000, 1}
+	for i, el := range first.(*object.Array).Elements {
+		n := el.(*object.Integer).Value
+		if n < 0 || n >= bounds[i] {
+			t.Errorf("random(%d) out of range: %d", bounds[i], n)
+		}
+	}
+
+	testErrorObject(t, testEval(`random(0)`), "argument to `random` must be positive, got 0")
+	testErrorObject(t, testEval(`random(-3)`), "argument to `random` must be positive, got -3")
+	testErrorObject(t, testEval(`random("a")`), "argument to `random` must be INTEGER, got STRING")
+	testErrorObject(t, testEval(`random()`), "wrong number of arguments. got=0, want=1")
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	clock := time.UnixMilli(1700000000123)
+	var slept []time.Duration
+	ev := New(Options{
+		Now:   func() time.Time { return clock },
+		Sleep: func(d time.Duration) { slept = append(slept, d); clock = clock.Add(d) },
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`now()`, 1700000000123},
+		{`let start = now(); sleep(250); now() - start`, 250},
+		{`sleep(0)`, nil},
+		{`sleep(-1)`, errorMessage("argument to `sleep` must not be negative, got -1")},
+		{`sleep("1")`, errorMessage("argument to `sleep` must be INTEGER, got STRING")},
+		{`now(1)`, errorMessage("wrong number of arguments. got=1, want=0")},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := ev.Eval(program, object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	if len(slept) != 2 || slept[0] != 250*time.Millisecond || slept[1] != 0 {
+		t.Errorf("wrong sleeps. got=%v", slept)
+	}
+}
+
+func TestPrintWritesWithoutNewline(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stdout)
+
+	evaluated := testEval(`print("a", 1 + 2, [1]); print(); print("b"); puts("!")`)
+	testNullObject(t, evaluated)
+
+	expected := "a 3 [1]b!\n"
+	if buf.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, buf.String())
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+	evaluated := testEval(input)
+	testStringObject(t, evaluated, "Hello World!")
+}
+
+func TestString(t *testing.T) {
+	input := `"hello world"`
+
+	testStringObject(t, testEval(input), "hello world")
+
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	strLit, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("expected obj to be of type *object.String. got=%T", obj)
+		return false
+	}
+	if strLit.Value != expected {
+		t.Errorf("expected Value to be %q. got=%q", expected, strLit.Value)
+		return false
+	}
+	return true
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+		let newAdder = fn(x){
+			return fn(y) {return x + y;};
+		};
+		let addTwo = newAdder(2);
+		return addTwo(2);
+		`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			"let f = fn(x){return x + 3;}; f(2);",
+			5,
+		},
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestVariadicFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(...rest) { len(rest) }; f(1, 2, 3);", 3},
+		{"let f = fn(...rest) { len(rest) }; f();", 0},
+		{"let f = fn(a, ...rest) { a + len(rest) }; f(10);", 10},
+		{"let f = fn(a, ...rest) { rest[1] }; f(1, 2, 3);", 3},
+		{"let f = fn(a, b, ...rest) { a }; f(1);", "wrong number of arguments. got=1, want at least 2"},
+		{"let f = fn(a, b) { a }; f(1);", "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1);", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2);", 3},
+		{"let f = fn(a = 1, b = 2) { a * 10 + b }; f();", 12},
+		{"let f = fn(a = 1, b = 2) { a * 10 + b }; f(3);", 32},
+		{"let f = fn(a, b = a * 2) { b }; f(4);", 8},
+		{"let n = 5; let f = fn(a = n) { a }; let g = fn() { let n = 1; f() }; g();", 5},
+		{"let calls = 0; let next = fn() { calls = calls + 1 }; let f = fn(a = next()) { a }; f(); f(9); f();", 2},
+		{"let f = fn(a, b = 1, ...rest) { a + b + len(rest) }; f(1);", 2},
+		{"let f = fn(a, b = 1, ...rest) { a + b + len(rest) }; f(1, 5, 7, 8);", 8},
+		{"let f = fn(a, b = 10) { a + b }; f();", errorMessage("wrong number of arguments. got=0, want at least 1")},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2, 3);", errorMessage("wrong number of arguments. got=3, want at most 2")},
+		{"let f = fn(a = missing) { a }; f();", errorMessage("identifier not found: missing")},
+		{"let f = fn(a = missing) { a }; f(1);", 1},
+		{"let f = fn(a, b = 2) { a + b }; let g = partial(f, 1); g();", 3},
+		{"let f = fn(a, b = 2) { a }; [arity(f), len(params(f))];", "[2, 2]"},
+		{"let f = fn(a, b = 2) { a }; f", "fn f(a, b = 2) {\na\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestTailRecursion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`let count = fn(n) { if (n == 0) { return 0; } count(n - 1) }; count(1000000)`,
+			0,
+		},
+		{
+			`let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(1000000, 0)`,
+			500000500000,
+		},
+		{
+			`let f = fn(n) { switch (n) { case 0: return 7; default: return f(n - 1); } }; f(200000)`,
+			7,
+		},
+		{
+			`let makeAdders = fn(n, acc) {
+				if (n == 0) { return acc; }
+				makeAdders(n - 1, push(acc, fn(x) { x + n }))
+			};
+			let adders = makeAdders(3, []);
+			adders[0](10) + adders[1](10) + adders[2](10)`,
+			36,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRecurBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`fn(n) { if (n < 2) { 1 } else { n * recur(n - 1) } }(5)`, 120},
+		{`let apply = fn(f, x) { f(x) }; apply(fn(n) { if (n == 0) { 0 } else { n + recur(n - 1) } }, 10)`, 55},
+		{`let outer = fn(n) { let inner = fn(m) { if (m == 0) { n } else { recur(m - 1) } }; inner(3) }; outer(7)`, 7},
+		{`let total = 0; times(3, fn(i) { if (i > 0) { total = total + 1; recur(i - 1) } }); total`, 3},
+		{`fn(a, b) { recur(a) }(1, 2)`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`recur(1)`, errorMessage("`recur` used outside of a function")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	input := `let f = fn(n) { 1 + f(n + 1) }; f(0)`
+
+	testErrorObject(t, testEval(input), "maximum recursion depth exceeded")
+
+	SetMaxCallDepth(50)
+	defer SetMaxCallDepth(10000)
+
+	evaluated := testEval(input)
+	if !testErrorObject(t, evaluated, "maximum recursion depth exceeded") {
+		return
+	}
+	// one frame per active call plus the call that was refused
+	if got := len(evaluated.(*object.Error).StackTrace); got != 51 {
+		t.Errorf("wrong stack trace length. want=51, got=%d", got)
+	}
+
+	testIntegerObject(t, testEval(`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(49)`), 49)
+	testIntegerObject(t, testEval(`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000)`), 0)
+
+	// A self tail call reuses its frame, so only an operation budget stops it.
+	runaway := parser.New(lexer.New(`let f = fn(){ f() }; f()`)).ParseProgram()
+	testErrorObject(t, New(Options{MaxOps: 10000}).Eval(runaway, object.NewEnvironment()), "operation limit exceeded")
+}
+
+func TestMaxOps(t *testing.T) {
+	ev := New(Options{MaxOps: 1000})
+	eval := func(input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return ev.Eval(program, object.NewEnvironment())
+	}
+
+	loop := `let f = fn(n) { f(n + 1) }; f(0)`
+	evaluated := eval(loop)
+	if testErrorObject(t, evaluated, "operation limit exceeded") {
+		if code := evaluated.(*object.Error).Code; code != object.LIMIT_ERROR {
+			t.Errorf("wrong error code. want=%s, got=%s", object.LIMIT_ERROR, code)
+		}
+	}
+
+	// the handler itself needs operations, so the limit can't be caught
+	testErrorObject(t, eval(`try { `+loop+` } catch (e) { 1 }`), "operation limit exceeded")
+
+	// each program gets a fresh budget
+	testIntegerObject(t, eval(`let f = fn(n) { if (n == 0) { n } else { f(n - 1) } }; f(20)`), 0)
+	testIntegerObject(t, eval(`let f = fn(n) { if (n == 0) { n } else { f(n - 1) } }; f(20)`), 0)
+
+	testIntegerObject(t, testEval(`let f = fn(n) { if (n == 0) { n } else { f(n - 1) } }; f(5000)`), 0)
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) {x + 2;};"
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T %+v", evaluated, evaluated)
+	}
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+	if len(fn.Body.Statements) != 1 {
+		t.Fatalf("function has wrong statements. Statements=%+v", fn.Body.Statements)
+	}
+	expectedBody := "(x + 2)"
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypeAnnotationsAreIgnored(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x: Int = 5; x`, 5},
+		{`let x: String = 5; x`, 5},
+		{`const n: Int = 2; n * 3`, 6},
+		{`let add = fn(a: Int, b: Int) { a + b }; add(1, 2)`, 3},
+		{`let f = fn(a: Int, ...rest: Array) { len(rest) }; f(1, 2, 3)`, 2},
+		{`let f = fn(a: Int) { a }; f("not checked")`, "not checked"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	fn, ok := testEval(`fn(a: Int, ...rest: Array) { a }`).(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function")
+	}
+	if sig := fn.Signature(); sig != "fn(a: Int, ...rest: Array)" {
+		t.Errorf("wrong signature. got=%q", sig)
+	}
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`if (true) { let x = 1 } x`, errorMessage("identifier not found: x")},
+		{`let x = 1; if (true) { let x = 2 }; x`, 1},
+		{`let x = 1; if (true) { let y = x + 1; y }`, 2},
+		{`let x = 1; if (true) { x = 2 }; x`, 2},
+		{`let x = 1; if (true) { let x = 5; x = 6 }; x`, 1},
+		{`let x = 1; let f = fn() { x = x + 1 }; f(); f(); x`, 3},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`switch (1) { case 1: let z = 1 } z`, errorMessage("identifier not found: z")},
+		{`try { let t = 1; t + true } catch (e) { 0 }; t`, errorMessage("identifier not found: t")},
+		{`y = 1`, errorMessage("identifier not found: y")},
+		{`const c = 1; if (true) { c = 2 }`, errorMessage("cannot reassign constant 'c'")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let [a, b] = [1, 2]; a * 10 + b`, 12},
+		{`let pair = fn() { [3, 4] }; let [a, b] = pair(); a + b`, 7},
+		{`let {x, y} = {"x": 5, "y": 6, "z": 7}; x * y`, 30},
+		{`let [a] = [1, 2]`, errorMessage("cannot destructure 2 elements into 1 names")},
+		{`let [a, b, c] = [1, 2]`, errorMessage("cannot destructure 2 elements into 3 names")},
+		{`let [a, b] = {"a": 1}`, errorMessage("cannot destructure HASH as ARRAY")},
+		{`let {x, y} = {"x": 1}`, errorMessage("cannot destructure missing key \"y\"")},
+		{`let {x} = [1]`, errorMessage("cannot destructure ARRAY as HASH")},
+		{`let [a, b] = [[1, 2], {"k": 3}]; a[1] + b["k"]`, 5},
+		{`const c = 1; let [c] = [2]`, errorMessage("cannot reassign constant 'c'")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let b = a * 2; b;", 10},
+		{"const a = 5; let a = 6;", "cannot reassign constant 'a'"},
+		{"const a = 5; const a = 6;", "cannot reassign constant 'a'"},
+		{"const a = 5; let f = fn() { let a = 6; a }; f();", 6},
+		{"const a = 5; let f = fn(a) { a }; f(7);", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestBooleanArithmeticErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true + 1", errorMessage("unknown operator: BOOLEAN + INTEGER")},
+		{"1 + true", errorMessage("unknown operator: INTEGER + BOOLEAN")},
+		{"false - 1", errorMessage("unknown operator: BOOLEAN - INTEGER")},
+		{"2 * true", errorMessage("unknown operator: INTEGER * BOOLEAN")},
+		{"10 / false", errorMessage("unknown operator: INTEGER / BOOLEAN")},
+		{"true < 1", errorMessage("unknown operator: BOOLEAN < INTEGER")},
+		{"1 | true", errorMessage("unknown operator: INTEGER | BOOLEAN")},
+		{"true + true", errorMessage("unknown operator: BOOLEAN + BOOLEAN")},
+		{`"a" + true`, errorMessage("unknown operator: STRING + BOOLEAN")},
+		{"-true", errorMessage("unknown operator: -BOOLEAN")},
+		{"true == 1", false},
+		{"true != 1", true},
+		{"int(true) + 1", 2},
+		{"int(1 > 2) * 5", 0},
+		{"bool(0) == true", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"unknown operator: INTEGER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"unknown operator: INTEGER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			`+"5"`,
+			"unknown operator: +STRING",
+		},
+		{
+			"-+true",
+			"unknown operator: +BOOLEAN",
+		},
+		{
+			"true + false;",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"if (10 > 1) { true + false; }",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`if (10 > 1) {
+				if (10 > 1) {
+					return true + false;
+				}
+				return 1;
+			}`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`"Hello" - "world"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			`{"name": "Monkey"}[[1]];`,
+			"unusable as hash key: ARRAY",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T %+v", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+	}{
+		{`1 + true`, object.TYPE_ERROR},
+		{`-"a"`, object.TYPE_ERROR},
+		{`5()`, object.TYPE_ERROR},
+		{`{[1]: 2}`, object.TYPE_ERROR},
+		{`missing`, object.NAME_ERROR},
+		{`missing = 1`, object.NAME_ERROR},
+		{`const c = 1; c = 2`, object.NAME_ERROR},
+		{`let a = [1]; a[3] = 0`, object.INDEX_ERROR},
+		{`fn(x) { x }()`, object.ARITY_ERROR},
+		{`first()`, object.ARITY_ERROR},
+		{`range(1, 2, 0)`, object.VALUE_ERROR},
+		{`9223372036854775807 + 1`, object.VALUE_ERROR},
+		{`assert(false, "nope")`, object.ASSERTION_ERROR},
+		{`let f = fn() { 1 + f() }; f()`, object.RECURSION_ERROR},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Code != tt.expectedCode {
+			t.Errorf("wrong error code for %q. expected=%q, got=%q", tt.input, tt.expectedCode, errObj.Code)
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let inner = fn() { 1 + true };
+let outer = fn() {
+	inner();
+};
+fn() { outer() }();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T %+v", evaluated, evaluated)
+	}
+
+	expected := []string{
+		"inner (line 3)",
+		"outer (line 5)",
+		"<anonymous> (line 5)",
+	}
+	if len(errObj.StackTrace) != len(expected) {
+		t.Fatalf("wrong number of frames. want=%d, got=%d (%v)", len(expected), len(errObj.StackTrace), errObj.StackTrace)
+	}
+	for i, frame := range expected {
+		if errObj.StackTrace[i] != frame {
+			t.Errorf("frame %d wrong. want=%q, got=%q", i, frame, errObj.StackTrace[i])
+		}
+	}
+}
+
+func TestErrorLine(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+	}{
+		{"1 + true", 1},
+		{"let x = 1;\nlet y = x + true;", 2},
+		{"let f = fn() {\n  let a = 1;\n  a + true\n};\nf()", 3},
+		{"if (true) {\n\n  missing\n}", 3},
+		{"let a = 1;\nswitch (a) {\ncase 1:\n  -true\n}", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T %+v", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Line != tt.line {
+			t.Errorf("wrong line for %q. want=%d, got=%d", tt.input, tt.line, errObj.Line)
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"[1, 2, 3][10] + undefinedVar", 1, 17},
+		{"let x = 1;\nlet y = x + true;", 2, 11},
+		{"let a = -true", 1, 9},
+		{"let h = {}; h[[1]]", 1, 14},
+		{"let x = 1;\n  len(x)", 2, 3},
+		{"let f = fn() {\n  let a = 1;\n  a + true\n};\nf()", 3, 5},
+		{"const c = 1; c = 2", 1, 16},
+		{"{[1]: 2}", 1, 1},
+		{`"héllo" - 1`, 1, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T %+v", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("wrong position for %q. want=%d:%d, got=%d:%d",
+				tt.input, tt.line, tt.column, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+	}{
+		{"let add = fn(a, b) { a + b }; add", "add"},
+		{"const sub = fn(a, b) { a - b }; sub", "sub"},
+		{"let add = fn(a, b) { a + b }; let plus = add; plus", "add"},
+		{"fn(a) { a }", ""},
+		{"let make = fn() { fn() { 1 } }; let made = make(); made", ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+		}
+		if fn.Name != tt.expectedName {
+			t.Errorf("fn.Name wrong. want=%q, got=%q", tt.expectedName, fn.Name)
+		}
+	}
+
+	evaluated := testEval("let add = fn(a, b) { a + b }; add")
+	expected := "fn add(a, b) {\n(a + b)\n}"
+	if evaluated.Inspect() != expected {
+		t.Errorf("Inspect() wrong. want=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestStackTraceUsesFunctionNames(t *testing.T) {
+	input := `let broken = fn() { 1 + true };
+let call = fn(f) { f() };
+call(broken);`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	expected := []string{"broken (line 2)", "call (line 3)"}
+	if len(errObj.StackTrace) != len(expected) {
+		t.Fatalf("wrong number of frames. want=%d, got=%d (%v)", len(expected), len(errObj.StackTrace), errObj.StackTrace)
+	}
+	for i, frame := range expected {
+		if errObj.StackTrace[i] != frame {
+			t.Errorf("frame %d wrong. want=%q, got=%q", i, frame, errObj.StackTrace[i])
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
 		{
 			`
 if (10 > 1) {
@@ -428,6 +2491,31 @@ f(10);`,
 	}
 }
 
+func TestBareReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn() { return; 5 }; f()", nil},
+		{"let f = fn(x) { if (x) { return } x }; f(false)", false},
+		{"let f = fn(x) { if (x) { return } x }; f(true)", nil},
+		{"let f = fn(x) { return x; }; f(3)", 3},
+		{"return; 5", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -440,6 +2528,36 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else if (3 > 2) { 40 }", 40},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSwitchStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`switch (2) { case 1: 10 case 2: 20 case 3: 30 }`, 20},
+		{`switch (1 + 2) { case 1: 10 case 2: 20 default: 99 }`, 99},
+		{`switch (4) { case 1: 10 }`, nil},
+		{`switch ("b") { case "a": 1 case "b": 2 }`, 2},
+		{`switch (true) { case 1 > 2: 1 case 2 > 1: 2 }`, 2},
+		{`switch (null) { case 0: 1 case null: 2 }`, 2},
+		{`switch (1) { case 1: 10 case 1: 20 }`, 10},
+		{`let f = fn(x) { switch (x) { case 1: return 10; default: return 0; }; 5 }; f(1)`, 10},
 	}
 
 	for _, tt := range tests {
@@ -453,6 +2571,36 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 + 1 } catch (e) { 0 }`, 2},
+		{`try { 1 + true } catch (e) { e }`, "unknown operator: INTEGER + BOOLEAN"},
+		{`try { missing } catch (e) { e }`, "identifier not found: missing"},
+		{`let f = fn() { 1 + true }; try { f(); 5 } catch (e) { len(e) }`, 35},
+		{`let r = try { [1][0] } catch (e) { -1 }; r`, 1},
+		{`let f = fn() { try { return 1; } catch (e) { 0 }; 2 }; f()`, 1},
+		{`try { 1 + true } catch (e) { e + 1 }`, errorMessage("type mismatch: STRING + INTEGER")},
+		{`try { [1, 2][5] = 0 } catch (e, code) { code }`, "INDEX_ERROR"},
+		{`try { len() } catch (e, code) { code }`, "ARITY_ERROR"},
+		{`try { assert(false) } catch (e, code) { if (code == "ASSERTION_ERROR") { e } else { "" } }`, "assertion failed"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T %+v", obj, obj)
@@ -461,6 +2609,134 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+func TestOptionalIndexExpressions(t *testing.T) {
+	user := `let user = {"name": "ann", "address": {"city": "Oslo"}, "tags": ["a"]};`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{user + `user?["address"]?["city"]`, "Oslo"},
+		{user + `user?["phone"]?["number"]`, nil},
+		{user + `user["phone"]?["number"]?["extension"]`, nil},
+		{user + `user?["tags"]?[0]`, "a"},
+		{user + `user?["tags"]?[5]`, nil},
+		{user + `user["phone"]?["number"] ?? "none"`, "none"},
+		{`null?[0]`, nil},
+		{`let calls = 0; let f = fn() { calls = calls + 1 }; null?[f()]; calls`, 0},
+		{user + `user["phone"]["number"]`, errorMessage("index operator not supported: NULL")},
+		{`1?[0]`, errorMessage("index operator not supported: INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestArrayAndHashAddition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`[1, 2] + [3]`, "[1, 2, 3]"},
+		{`[] + []`, "[]"},
+		{`[[1]] + [2] + []`, "[[1], 2]"},
+		{`let a = [1]; let b = a + [2]; b[0] = 9; [a, b]`, "[[1], [9, 2]]"},
+		{`{"a": 1, "b": 2} + {"c": 3}`, "{a: 1, b: 2, c: 3}"},
+		{`{"a": 1, "b": 2} + {"b": 20, "c": 3}`, "{a: 1, b: 20, c: 3}"},
+		{`{"b": 2, "a": 1} + {"a": 10}`, "{b: 2, a: 10}"},
+		{`{} + {}`, "{}"},
+		{`let h = {"a": 1}; let m = h + {"b": 2}; m["a"] = 5; [h, m]`, "[{a: 1}, {a: 5, b: 2}]"},
+		{`{"a": 1} + {"a": 2} == {"a": 2}`, "true"},
+		{`[1] + {"a": 1}`, errorMessage("type mismatch: ARRAY + HASH")},
+		{`{"a": 1} + [1]`, errorMessage("type mismatch: HASH + ARRAY")},
+		{`[1] + 1`, errorMessage("type mismatch: ARRAY + INTEGER")},
+		{`[1] - [1]`, errorMessage("unknown operator: ARRAY - ARRAY")},
+		{`{} * {}`, errorMessage("unknown operator: HASH * HASH")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestCoalesceOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`null ?? 5`, 5},
+		{`1 ?? 5`, 1},
+		{`false ?? 5`, false},
+		{`{"a": 1}["b"] ?? 2`, 2},
+		{`{"a": 1}["a"] ?? 2`, 1},
+		{`null ?? null ?? 3`, 3},
+		{`null ?? null`, nil},
+		{`1 ?? undefined`, 1},
+		{`null ?? undefined`, errorMessage("identifier not found: undefined")},
+		{`let calls = 0; let f = fn() { calls = calls + 1 }; 1 ?? f(); calls`, 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestPipeOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let double = fn(x) { x * 2 }; 5 |> double`, 10},
+		{`let sub = fn(a, b) { a - b }; 10 |> sub(3)`, 7},
+		{`let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; 3 |> inc |> double |> inc`, 9},
+		{`[1, 2, 3] |> push(4) |> rest |> len`, 3},
+		{`"a,b,c" |> split(",") |> join("-")`, "a-b-c"},
+		{`2 |> fn(x) { x * x }`, 4},
+		{`1 + 2 |> fn(x) { x * 10 }`, 30},
+		{`5 |> 3`, errorMessage("cannot call non-function object as a function: INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -472,12 +2748,55 @@ func TestBangOperator(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"!null", true},
+		{"!0", false},
+		{"!-1", false},
+		{`!""`, false},
+		{`!"a"`, false},
+		{"![]", false},
+		{"!{}", false},
+		{"!fn() {}", false},
+		{"!len", false},
+		{"!(1 > 2)", true},
+		{"!!null", false},
+		{"not(true)", false},
+		{"not(false)", true},
+		{"not(null)", true},
+		{"not(0)", false},
+		{`not("")`, false},
+		{"not([])", false},
+		{"not(not(5))", true},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
+
+	testErrorObject(t, testEval("not()"), "wrong number of arguments. got=0, want=1")
+}
+
+func TestTruthinessOfHostValues(t *testing.T) {
+	ev := New(Options{})
+	if err := ev.RegisterBuiltin("hostFalse", func(args ...object.Object) object.Object {
+		return &object.Boolean{Value: false}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`if (hostFalse()) { 1 } else { 2 }`, 2},
+		{`if (!hostFalse()) { 1 } else { 2 }`, 1},
+		{`if (not(hostFalse())) { 1 } else { 2 }`, 1},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), tt.expected)
+	}
 }
 
 func TestEvalBooleanExpression(t *testing.T) {
@@ -512,6 +2831,76 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestCrossTypeEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`5 == "5"`, false},
+		{`5 != "5"`, true},
+		{`null == null`, true},
+		{`null == 0`, false},
+		{`null != false`, true},
+		{`"a" == null`, false},
+		{`[] == {}`, false},
+		{`true == 1`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, 2] != [2, 1]`, true},
+		{`{"a": [1]} == {"a": [1]}`, true},
+		{`let f = fn() {}; f == f`, true},
+		{`fn() {} == fn() {}`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEqualityWithHostValues(t *testing.T) {
+	host := map[string]*object.Builtin{
+		"yes": {Fn: func(args ...object.Object) object.Object {
+			return &object.Boolean{Value: true}
+		}},
+		"no": {Fn: func(args ...object.Object) object.Object {
+			return &object.Boolean{Value: false}
+		}},
+		"nothing": {Fn: func(args ...object.Object) object.Object {
+			return &object.Null{}
+		}},
+	}
+	cyclic := &object.Array{}
+	cyclic.Elements = []object.Object{cyclic}
+	host["cyclic"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return cyclic
+	}}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`yes() == true`, true},
+		{`yes() != true`, false},
+		{`no() == false`, true},
+		{`yes() == no()`, false},
+		{`[yes()] == [true]`, true},
+		{`equals({"k": no()}, {"k": false})`, true},
+		{`contains([1, yes()], true)`, true},
+		{`switch (yes()) { case false: false case true: true default: false }`, true},
+		{`nothing() == null`, true},
+		{`nothing() == false`, false},
+		{`let c = cyclic(); c == c`, true},
+		{`let c = cyclic(); equals(c, c)`, true},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(Options{Builtins: host}).Eval(program, object.NewEnvironment())
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	boolObj, ok := obj.(*object.Boolean)
 	if !ok {
@@ -547,6 +2936,14 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"+5", 5},
+		{"+-5", -5},
+		{"-+5", -5},
+		{"--5", 5},
+		{"++5", 5},
+		{"-(-(-5))", -5},
+		{"3 - +2", 1},
+		{"3 - -2", 5},
 	}
 
 	for _, tt := range tests {
@@ -555,6 +2952,93 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"-9223372036854775807 - 2", "integer overflow"},
+		{"-9223372036854775807 + -2", "integer overflow"},
+		{"9223372036854775807 - -1", "integer overflow"},
+		{"4611686018427387904 * 2", "integer overflow"},
+		{"4611686018427387903 * 2", 9223372036854775806},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"(-9223372036854775807 - 1) * -1", "integer overflow"},
+		{"-1 * (-9223372036854775807 - 1)", "integer overflow"},
+		{"0 * 9223372036854775807", 0},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow"},
+		{"-(-9223372036854775807 - 1)", "integer overflow"},
+		{"-(-9223372036854775807)", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestIntegerDivision(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"6 / 2", 3},
+		{"5 / 2", 2},
+		{"-7 / 2", -3},
+		{"7 / -2", -3},
+		{"0 / 5", 0},
+		{"5 / 0", errorMessage("division by zero")},
+		{"let z = 0; 1 + 10 / z", errorMessage("division by zero")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"1 << 4", 16},
+		{"256 >> 4", 16},
+		{"-16 >> 2", -4},
+		{"1 << 63", -9223372036854775808},
+		{"1 | 2 ^ 3 & 6", 1},
+		{"1 << 64", "invalid shift amount: 64"},
+		{"1 >> -1", "invalid shift amount: -1"},
+		{"true & false", "unknown operator: BOOLEAN & BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -0,0 +1,34 @@
+package evaluator_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hudsn/learn-interpreter/evaluator"
+	"github.com/hudsn/learn-interpreter/lexer"
+	"github.com/hudsn/learn-interpreter/object"
+	"github.com/hudsn/learn-interpreter/parser"
+)
+
+func ExampleEvaluator_RegisterBuiltin() {
+	ev := evaluator.New(evaluator.Options{})
+
+	err := ev.RegisterBuiltin("unix", func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=0", len(args)), Code: object.ARITY_ERROR}
+		}
+		return &object.Integer{Value: time.Now().Unix()}
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	program := parser.New(lexer.New(`unix() > 1700000000`)).ParseProgram()
+	fmt.Println(ev.Eval(program, object.NewEnvironment()).Inspect())
+
+	fmt.Println(ev.RegisterBuiltin("len", nil))
+	// Output:
+	// true
+	// builtin "len" already exists
+}
@@ -1,6 +1,11 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/hudsn/learn-interpreter/token"
 )
 
@@ -9,15 +14,22 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
+	// lineStart is the position of the first character on the current line.
+	lineStart int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -31,6 +43,8 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	line := l.line
+	column := l.position - l.lineStart + 1
 
 	switch l.ch {
 	case '=':
@@ -52,6 +66,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
@@ -70,9 +92,40 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: "<<"}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: ">>"}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.COALESCE, Literal: "??"}
+		} else if l.peekChar() == '[' {
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL_LBRACKET, Literal: "?["}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '&':
+		tok = newToken(token.BIT_AND, l.ch)
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: "|>"}
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -82,25 +135,44 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		str, err := l.readString()
+		if err != "" {
+			tok.Type = token.ERROR
+			tok.Literal = err
+		} else {
+			tok.Type = token.STRING
+			tok.Literal = str
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if isLetter(l.ch) {
+		if l.ch == '_' && isDigit(l.peekChar()) {
+			// identifiers can't contain digits, so this is a number with a
+			// leading separator
+			_, tok.Literal = l.readNumber()
+			tok.Type = token.ILLEGAL
+			tok.Line = line
+			tok.Column = column
+			return tok
+		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line = line
+			tok.Column = column
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Line = line
+			tok.Column = column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
+	tok.Line = line
+	tok.Column = column
 	l.readChar()
 	return tok
 }
@@ -119,18 +191,64 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads a decimal literal, or a hex, octal, or binary one when it
+// starts with 0x, 0o, or 0b. Underscores may separate digits, e.g. 1_000_000.
+// A literal with no digits, digits outside its base, or a leading, trailing,
+// or doubled underscore comes back as an ILLEGAL token.
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
-	for isDigit(l.ch) {
+
+	base := 10
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+	if base != 10 {
+		l.readChar()
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	digits := l.position
+	valid := true
+	for isLetter(l.ch) || isDigit(l.ch) {
+		if base == 10 && !isDigit(l.ch) && l.ch != '_' {
+			break
+		}
+		if l.ch != '_' && !isDigitInBase(l.ch, base) {
+			valid = false
+		}
+		l.readChar()
+	}
+
+	literal := l.input[position:l.position]
+	if !valid || !validSeparators(l.input[digits:l.position]) {
+		return token.ILLEGAL, literal
+	}
+	return token.INT, literal
 }
 
-func (l *Lexer) readString() string {
+// validSeparators reports whether digits is non-empty and every underscore in
+// it sits between two digits.
+func validSeparators(digits string) bool {
+	if digits == "" || digits[0] == '_' || digits[len(digits)-1] == '_' {
+		return false
+	}
+	return !strings.Contains(digits, "__")
+}
+
+// readString reads a string literal and decodes its escapes. A malformed
+// escape is reported through the second result, with its position; the rest
+// of the string is still consumed so lexing can carry on after it.
+func (l *Lexer) readString() (string, string) {
 	l.readChar()
-	// startPosition := l.position
-	str := []rune{}
+	str := []byte{}
+	errMsg := ""
 	for l.ch != '"' && l.ch != 0 {
 		toAdd := l.ch
 		if l.ch == '\\' {
@@ -144,13 +262,77 @@ func (l *Lexer) readString() string {
 			case '"':
 				toAdd = '"'
 				l.readChar()
+			case '\\':
+				l.readChar()
+			case 'x', 'u':
+				decoded, err := l.readCodeEscape()
+				if err != "" && errMsg == "" {
+					errMsg = err
+				}
+				str = append(str, decoded...)
+				l.readChar()
+				continue
 			}
 		}
-		str = append(str, rune(toAdd))
+		str = append(str, toAdd)
 		l.readChar()
 	}
-	// return l.input[startPosition:l.position]
-	return string(str)
+	return string(str), errMsg
+}
+
+// readCodeEscape decodes \xHH into a byte, and \uHHHH or \u{H...} into the
+// UTF-8 encoding of a code point. It leaves l.ch on the escape's last character.
+func (l *Lexer) readCodeEscape() ([]byte, string) {
+	start := l.position
+	column := l.position - l.lineStart + 1
+	l.readChar()
+	kind := l.ch
+
+	var digits string
+	switch {
+	case kind == 'x':
+		digits = l.readHexDigits(2)
+	case l.peekChar() == '{':
+		l.readChar()
+		for isDigitInBase(l.peekChar(), 16) {
+			l.readChar()
+		}
+		digits = l.input[start+3 : l.position+1]
+		if l.peekChar() != '}' {
+			digits = ""
+		} else {
+			l.readChar()
+		}
+	default:
+		digits = l.readHexDigits(4)
+	}
+
+	escape := l.input[start : l.position+1]
+	invalid := fmt.Sprintf("invalid escape sequence %q at line %d, column %d", escape, l.line, column)
+	if digits == "" || len(digits) > 6 {
+		return nil, invalid
+	}
+
+	value, _ := strconv.ParseUint(digits, 16, 32)
+	if kind == 'x' {
+		return []byte{byte(value)}, ""
+	}
+	if !utf8.ValidRune(rune(value)) {
+		return nil, invalid
+	}
+	return utf8.AppendRune(nil, rune(value)), ""
+}
+
+// readHexDigits consumes exactly n hex digits following the current
+// character, returning "" if there aren't that many.
+func (l *Lexer) readHexDigits(n int) string {
+	for i := 0; i < n; i++ {
+		if !isDigitInBase(l.peekChar(), 16) {
+			return ""
+		}
+		l.readChar()
+	}
+	return l.input[l.position-n+1 : l.position+1]
 }
 
 func (l *Lexer) peekChar() byte {
@@ -160,6 +342,14 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
+// peekCharAt looks offset characters past the next one without consuming anything.
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+offset]
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
@@ -168,6 +358,19 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isDigitInBase(ch byte, base int) bool {
+	switch base {
+	case 2:
+		return ch == '0' || ch == '1'
+	case 8:
+		return '0' <= ch && ch <= '7'
+	case 16:
+		return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+	default:
+		return isDigit(ch)
+	}
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -30,9 +30,19 @@ if (5 < 10) {
 "foo bar"
 "new\"line"
 "new\n\n\tline\""
+"héllo"
 array[]
 [1, 2];
 {"foo": bar};
+fn(...rest)
+null
+switch case default
+const
+try catch
+a & b | c ^ d << e >> f
+x ?? y
+x |> f
+a?[b]
 `
 
 	tests := []struct {
@@ -118,6 +128,7 @@ array[]
 		{token.STRING, "foo bar"},
 		{token.STRING, "new\"line"},
 		{token.STRING, "new\n\n\tline\""},
+		{token.STRING, "héllo"},
 		{token.IDENT, "array"},
 		{token.LBRACKET, "["},
 		{token.RBRACKET, "]"},
@@ -133,6 +144,39 @@ array[]
 		{token.IDENT, "bar"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.NULL, "null"},
+		{token.SWITCH, "switch"},
+		{token.CASE, "case"},
+		{token.DEFAULT, "default"},
+		{token.CONST, "const"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.IDENT, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "c"},
+		{token.BIT_XOR, "^"},
+		{token.IDENT, "d"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENT, "e"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENT, "f"},
+		{token.IDENT, "x"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "y"},
+		{token.IDENT, "x"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.IDENT, "a"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
 		{token.EOF, ""},
 	}
 
@@ -150,3 +194,156 @@ array[]
 		}
 	}
 }
+
+func TestTokenLines(t *testing.T) {
+	input := `let x = 5;
+let s = "a
+b";
+x`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.LET, 2, 1},
+		{token.IDENT, 2, 5},
+		{token.ASSIGN, 2, 7},
+		{token.STRING, 2, 9},
+		{token.SEMICOLON, 3, 3},
+		{token.IDENT, 4, 1},
+		{token.EOF, 4, 2},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine {
+			t.Fatalf("tests[%d] - line wrong. expected=%d, got=%d", i, tt.expectedLine, tok.Line)
+		}
+
+		if tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+		}
+	}
+}
+
+func TestRadixIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"0xFF", token.INT, "0xFF"},
+		{"0Xff", token.INT, "0Xff"},
+		{"0o17", token.INT, "0o17"},
+		{"0b1010", token.INT, "0b1010"},
+		{"0x7FFFFFFFFFFFFFFF", token.INT, "0x7FFFFFFFFFFFFFFF"},
+		{"0", token.INT, "0"},
+		{"0x", token.ILLEGAL, "0x"},
+		{"0xFG", token.ILLEGAL, "0xFG"},
+		{"0o18", token.ILLEGAL, "0o18"},
+		{"0b102", token.ILLEGAL, "0b102"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected %q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after literal, got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestDigitSeparators(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"1_000_000", token.INT, "1_000_000"},
+		{"0xFF_FF", token.INT, "0xFF_FF"},
+		{"0b1010_1010", token.INT, "0b1010_1010"},
+		{"1_0", token.INT, "1_0"},
+		{"_100", token.ILLEGAL, "_100"},
+		{"100_", token.ILLEGAL, "100_"},
+		{"1__0", token.ILLEGAL, "1__0"},
+		{"0x_FF", token.ILLEGAL, "0x_FF"},
+		{"0xFF_", token.ILLEGAL, "0xFF_"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected %q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after literal, got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"\x41\x42"`, token.STRING, "AB"},
+		{`"\u00e9"`, token.STRING, "\xc3\xa9"},
+		{`"\u{e9}"`, token.STRING, "é"},
+		{`"\u{1F412}!"`, token.STRING, "\xf0\x9f\x90\x92!"},
+		{`"a\\b"`, token.STRING, `a\b`},
+		{`"\\x41"`, token.STRING, `\x41`},
+		{`"\x4G"`, token.ERROR, `invalid escape sequence "\\x4" at line 1, column 2`},
+		{`"ab\u00"`, token.ERROR, `invalid escape sequence "\\u00" at line 1, column 4`},
+		{"\n \"\\u{110000}\"", token.ERROR, `invalid escape sequence "\\u{110000}" at line 2, column 3`},
+		{`"\u{}"`, token.ERROR, `invalid escape sequence "\\u{}" at line 1, column 2`},
+		{`"\u{41"`, token.ERROR, `invalid escape sequence "\\u{41" at line 1, column 2`},
+		{`"\uD800"`, token.ERROR, `invalid escape sequence "\\uD800" at line 1, column 2`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected %q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after literal, got=%q", i, next.Type)
+		}
+	}
+}
@@ -1,21 +1,98 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/user"
 
+	"github.com/hudsn/learn-interpreter/evaluator"
 	"github.com/hudsn/learn-interpreter/repl"
 )
 
 func main() {
+	os.Exit(run(os.Args[0], os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main with its arguments and streams passed in, returning the exit
+// status: 0 on success, 1 when the script fails, and 2 for bad flags.
+func run(name string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var printResult bool
+	var maxOps int
+	var jsonOutput bool
+	var color bool
+	var prompt string
+	flags.BoolVar(&printResult, "p", false, "print the value of the script's final statement")
+	flags.BoolVar(&printResult, "print", false, "print the value of the script's final statement")
+	flags.BoolVar(&jsonOutput, "json", false, "report the script's result or error as a JSON object")
+	flags.BoolVar(&color, "color", false, "print REPL errors in color when stdout is a terminal and NO_COLOR is unset")
+	flags.StringVar(&prompt, "prompt", repl.PROMPT, "the REPL's input `prompt`")
+	flags.IntVar(&maxOps, "max-ops", evaluator.DefaultMaxOps, "abort a script or REPL line after evaluating `n` operations (0 means no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [-p] [--json] [--max-ops n] [--color] [--prompt s] [file]\n\n", name)
+		fmt.Fprintf(flags.Output(), "Runs file as a script, or starts the REPL when no file is given.\n")
+		fmt.Fprintf(flags.Output(), "With -p, a top-level return ends the script and its value is printed.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		return runFile(flags.Arg(0), printResult, jsonOutput, maxOps, stdout, stderr)
+	}
+
 	user, err := user.Current()
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(stderr, err)
+		return 1
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	fmt.Fprintf(stdout, "Hello %s! This is the Monkey programming language!\n", user.Username)
+	fmt.Fprintf(stdout, "Feel free to type in commands\n")
+	repl.StartWith(stdin, stdout, repl.Options{Prompt: prompt, Color: color && colorSupported(), MaxOps: maxOps})
+	return 0
+}
 
+// colorSupported follows the NO_COLOR convention (https://no-color.org) and
+// keeps escape codes out of stdout when it is redirected to a file or pipe.
+func colorSupported() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// runFile runs the script at path and returns the exit status for it.
+func runFile(path string, printResult bool, jsonOutput bool, maxOps int, stdout io.Writer, stderr io.Writer) int {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	opts := evaluator.Options{Output: stdout, MaxOps: maxOps, AllowIO: true}
+	if jsonOutput {
+		// the JSON object already describes any failure
+		if err := repl.RunJSON(string(src), opts); err != nil {
+			return 1
+		}
+		return 0
+	}
+	if err := repl.Run(string(src), opts, printResult); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript saves src to a file in a temporary directory and returns its path.
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunPrintFlag(t *testing.T) {
+	tests := []struct {
+		flags    []string
+		src      string
+		expected string
+	}{
+		{[]string{"-p"}, `let x = 2; x * 21`, "42\n"},
+		{[]string{"--print"}, `[1, "a"]`, "[1, a]\n"},
+		{[]string{"-p"}, `puts("hi"); return 1; 2`, "hi\n1\n"},
+		{[]string{"-p"}, `let x = 1;`, ""},
+		{nil, `puts("hi"); 42`, "hi\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		args := append(tt.flags, writeScript(t, tt.src))
+		if status := run("monkey", args, strings.NewReader(""), &stdout, &stderr); status != 0 {
+			t.Errorf("run(%v) exited with %d. stderr=%q", tt.flags, status, stderr.String())
+		}
+		if stdout.String() != tt.expected {
+			t.Errorf("wrong output for %q with %v. want=%q, got=%q", tt.src, tt.flags, tt.expected, stdout.String())
+		}
+	}
+}
+
+func TestRunExitStatus(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedStatus int
+		expectedStderr string
+	}{
+		{[]string{"-p", writeScript(t, `1 + true`)}, 1, "ERROR: unknown operator: INTEGER + BOOLEAN"},
+		{[]string{"-p", writeScript(t, `let x = `)}, 1, "parser errors:"},
+		{[]string{"-p", filepath.Join(t.TempDir(), "missing.mk")}, 1, "no such file or directory"},
+		{[]string{"--max-ops", "10", writeScript(t, `let f = fn(n) { f(n + 1) }; f(0)`)}, 1, "operation limit exceeded"},
+		{[]string{"--max-ops", "10000", writeScript(t, `let f = fn(){ f() }; f()`)}, 1, "operation limit exceeded"},
+		{[]string{"--no-such-flag"}, 2, "flag provided but not defined"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if status := run("monkey", tt.args, strings.NewReader(""), &stdout, &stderr); status != tt.expectedStatus {
+			t.Errorf("run(%v) exited with %d, want %d", tt.args, status, tt.expectedStatus)
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("run(%v) stderr does not contain %q. got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestRunREPLFlags(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+
+	var stdout, stderr bytes.Buffer
+	if status := run("monkey", []string{"--prompt", "monkey> ", "--color"}, strings.NewReader("1 + 1\nlen(1)\n"), &stdout, &stderr); status != 0 {
+		t.Fatalf("run exited with %d. stderr=%q", status, stderr.String())
+	}
+
+	// NO_COLOR overrides --color
+	want := "monkey> 2\nmonkey> ERROR: argument to `len` must be STRING, ARRAY, or HASH, got INTEGER\n  len(1)\n  ^\nmonkey> "
+	if !strings.HasSuffix(stdout.String(), want) {
+		t.Errorf("wrong REPL transcript. want suffix=%q, got=%q", want, stdout.String())
+	}
+}
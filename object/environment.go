@@ -1,8 +1,14 @@
 package object
 
+import (
+	"fmt"
+	"sort"
+)
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool
+	outer  *Environment
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -13,7 +19,8 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	c := make(map[string]bool)
+	return &Environment{store: s, consts: c, outer: nil}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -24,7 +31,96 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Names lists every name visible from this scope, including those bound in
+// outer scopes, sorted and without duplicates.
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Set binds name in the local store. It returns an *Error instead of val when
+// name is already bound to a constant in this scope.
 func (e *Environment) Set(name string, val Object) Object {
+	if e.consts[name] {
+		return constantError(name)
+	}
 	e.store[name] = val
 	return val
 }
+
+// SetConst binds name like Set and marks it so later Set calls in this scope fail.
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts[name] {
+		return constantError(name)
+	}
+	e.store[name] = val
+	e.consts[name] = true
+	return val
+}
+
+// Assign rebinds name in the innermost scope that already defines it,
+// returning an *Error if no scope does or if that binding is constant.
+func (e *Environment) Assign(name string, val Object) Object {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.Set(name, val)
+		}
+	}
+	return &Error{Message: fmt.Sprintf("identifier not found: %s", name), Code: NAME_ERROR}
+}
+
+// Delete removes name from the local store, constant or not, and reports
+// whether it was bound there. Bindings in outer scopes are left alone, so
+// deleting a name this scope only inherits is a no-op that returns false.
+func (e *Environment) Delete(name string) bool {
+	if _, ok := e.store[name]; !ok {
+		return false
+	}
+	delete(e.store, name)
+	delete(e.consts, name)
+	return true
+}
+
+// Snapshot copies this scope's bindings so they can be put back with Restore
+// after evaluating code that might change them. The copy is shallow: adding,
+// removing, or rebinding names is undone by Restore, but changes made inside
+// a value, such as arr[0] = 1 or h["k"] = v, are shared and are not. Outer
+// scopes are shared too.
+func (e *Environment) Snapshot() *Environment {
+	snap := &Environment{
+		store:  make(map[string]Object, len(e.store)),
+		consts: make(map[string]bool, len(e.consts)),
+		outer:  e.outer,
+	}
+	for name, val := range e.store {
+		snap.store[name] = val
+	}
+	for name := range e.consts {
+		snap.consts[name] = true
+	}
+	return snap
+}
+
+// Restore resets this scope's bindings to those captured by Snapshot. The
+// snapshot is copied again, so it can be restored more than once.
+func (e *Environment) Restore(snap *Environment) {
+	copied := snap.Snapshot()
+	e.store = copied.store
+	e.consts = copied.consts
+}
+
+func constantError(name string) *Error {
+	return &Error{Message: fmt.Sprintf("cannot reassign constant '%s'", name), Code: NAME_ERROR}
+}
@@ -0,0 +1,124 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("b", &Integer{Value: 1})
+	outer.Set("shadowed", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("a", &Integer{Value: 3})
+	inner.Set("shadowed", &Integer{Value: 4})
+
+	expected := []string{"a", "b", "shadowed"}
+	if names := inner.Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("inner.Names() wrong. want=%v, got=%v", expected, names)
+	}
+
+	expected = []string{"b", "shadowed"}
+	if names := outer.Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("outer.Names() wrong. want=%v, got=%v", expected, names)
+	}
+
+	if names := NewEnvironment().Names(); len(names) != 0 {
+		t.Errorf("empty environment has names. got=%v", names)
+	}
+}
+
+func TestEnvironmentDelete(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.Set("shadowed", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("shadowed", &Integer{Value: 3})
+	inner.SetConst("c", &Integer{Value: 4})
+
+	if inner.Delete("a") {
+		t.Errorf("inner.Delete(a) removed an outer binding")
+	}
+	if _, ok := inner.Get("a"); !ok {
+		t.Errorf("a is no longer visible from inner")
+	}
+
+	if !inner.Delete("shadowed") {
+		t.Errorf("inner.Delete(shadowed) reported no binding")
+	}
+	if obj, _ := inner.Get("shadowed"); obj.(*Integer).Value != 2 {
+		t.Errorf("shadowed should resolve to the outer binding. got=%s", obj.Inspect())
+	}
+
+	if !inner.Delete("c") {
+		t.Errorf("inner.Delete(c) reported no binding")
+	}
+	if result := inner.Set("c", &Integer{Value: 5}); result.Type() == ERROR_OBJ {
+		t.Errorf("c is still constant after delete: %s", result.Inspect())
+	}
+
+	if inner.Delete("missing") {
+		t.Errorf("inner.Delete(missing) reported a binding")
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.SetConst("c", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Assign("a", &Integer{Value: 3})
+
+	if obj, _ := outer.Get("a"); obj.(*Integer).Value != 3 {
+		t.Errorf("Assign did not update the outer binding. got=%s", obj.Inspect())
+	}
+	if _, ok := inner.store["a"]; ok {
+		t.Errorf("Assign created a local binding")
+	}
+
+	if result := inner.Assign("c", &Integer{Value: 4}); result.Type() != ERROR_OBJ {
+		t.Errorf("Assign to constant did not fail. got=%s", result.Inspect())
+	}
+
+	if result := inner.Assign("missing", &Integer{Value: 5}); result.Type() != ERROR_OBJ {
+		t.Errorf("Assign to unbound name did not fail. got=%s", result.Inspect())
+	}
+}
+
+func TestEnvironmentSnapshotRestore(t *testing.T) {
+	env := NewEnvironment()
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+	env.Set("a", &Integer{Value: 1})
+	env.Set("arr", arr)
+
+	snap := env.Snapshot()
+
+	env.Set("a", &Integer{Value: 2})
+	env.Set("b", &Integer{Value: 3})
+	env.SetConst("c", &Integer{Value: 4})
+	arr.Elements[0] = &Integer{Value: 5}
+
+	env.Restore(snap)
+
+	if obj, _ := env.Get("a"); obj.(*Integer).Value != 1 {
+		t.Errorf("a was not restored. got=%s", obj.Inspect())
+	}
+	if _, ok := env.Get("b"); ok {
+		t.Errorf("b is still bound after restore")
+	}
+	if result := env.Set("c", &Integer{Value: 6}); result.Type() == ERROR_OBJ {
+		t.Errorf("c is still constant after restore")
+	}
+	if obj, _ := env.Get("arr"); obj.(*Array).Elements[0].(*Integer).Value != 5 {
+		t.Errorf("array contents should be shared with the snapshot. got=%s", obj.Inspect())
+	}
+
+	env.Set("d", &Integer{Value: 7})
+	env.Restore(snap)
+	if _, ok := env.Get("d"); ok {
+		t.Errorf("d is still bound after restoring the snapshot a second time")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/hudsn/learn-interpreter/ast"
 )
@@ -31,6 +33,7 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	ITERATOR_OBJ     = "ITERATOR"
 )
 
 type Integer struct {
@@ -77,32 +80,87 @@ func (rv *ReturnValue) Inspect() string {
 }
 
 type Function struct {
+	// Name is set when the function literal is bound directly with let or
+	// const, and is empty for anonymous functions.
+	Name        string
 	Parameters  []*ast.Identifier
+	Variadic    bool
 	Body        *ast.BlockStatement
 	Environment *Environment
+
+	// id identifies the function for HashKey, assigned on first use.
+	id uint64
+}
+
+// lastFunctionID is the most recently assigned Function id.
+var lastFunctionID atomic.Uint64
+
+// HashKey lets functions be hash keys. Functions compare by identity, not
+// structure: two evaluations of the same literal produce different keys.
+func (f *Function) HashKey() HashKey {
+	if f.id == 0 {
+		f.id = lastFunctionID.Add(1)
+	}
+	return HashKey{Type: f.Type(), Value: f.id}
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	signature := f.Signature()
+	if f.Name != "" {
+		signature = "fn " + f.Name + strings.TrimPrefix(signature, "fn")
 	}
 
-	out.WriteString("fn")
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
+	out.WriteString(signature)
+	out.WriteString(" {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
 
 	return out.String()
 }
 
+// Signature renders the function's parameter list, e.g. fn(a, b = 1, ...rest).
+func (f *Function) Signature() string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, ast.ParameterString(p))
+	}
+	if f.Variadic {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
+
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+// Error codes classify runtime errors so catch handlers can branch on the
+// kind of failure without parsing messages.
+const (
+	TYPE_ERROR      = "TYPE_ERROR"
+	INDEX_ERROR     = "INDEX_ERROR"
+	ARITY_ERROR     = "ARITY_ERROR"
+	NAME_ERROR      = "NAME_ERROR"
+	VALUE_ERROR     = "VALUE_ERROR"
+	ASSERTION_ERROR = "ASSERTION_ERROR"
+	RECURSION_ERROR = "RECURSION_ERROR"
+	LIMIT_ERROR     = "LIMIT_ERROR"
+	IO_ERROR        = "IO_ERROR"
+)
+
 type Error struct {
 	Message string
+	// Code is one of the error code constants above.
+	Code string
+	// StackTrace holds one frame per user function the error unwound through,
+	// most recent call first.
+	StackTrace []string
+	// Line is the source line of the innermost expression or statement that
+	// failed, or 0 when it is unknown.
+	Line int
+	// Column is the 1-based byte offset within Line of the expression that
+	// failed, or 0 when only the line is known.
+	Column int
 }
 
 func (e Error) Type() ObjectType {
@@ -128,6 +186,8 @@ type BuiltInFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltInFunction
+	// Doc is a one-line description shown by the REPL's :help.
+	Doc string
 }
 
 func (b *Builtin) Inspect() string {
@@ -137,6 +197,21 @@ func (b *Builtin) Type() ObjectType {
 	return BUILTIN_OBJ
 }
 
+// Iterator produces values lazily by calling Generator, a function of no
+// arguments, until it returns null. Done is set once that happens so the
+// generator isn't called again.
+type Iterator struct {
+	Generator Object
+	Done      bool
+}
+
+func (it *Iterator) Inspect() string {
+	return "iterator"
+}
+func (it *Iterator) Type() ObjectType {
+	return ITERATOR_OBJ
+}
+
 type Array struct {
 	Elements []Object
 }
@@ -154,6 +229,59 @@ func (a *Array) Type() ObjectType {
 	return ARRAY_OBJ
 }
 
+// InspectIndented is like Inspect but puts each element on its own line,
+// indenting nested arrays and hashes.
+func (a *Array) InspectIndented() string {
+	return inspectIndented(a, 0)
+}
+
+// truncatedTail is how many trailing elements InspectTruncated keeps after
+// the marker for the ones it leaves out.
+const truncatedTail = 2
+
+// InspectTruncated is like Inspect but shows at most limit leading elements
+// and the last few of each array, nested ones included even inside hashes,
+// with a marker for how many were left out. A limit of zero or less shows
+// everything.
+func (a *Array) InspectTruncated(limit int) string {
+	elStrings := []string{}
+	for i, entry := range a.Elements {
+		if limit > 0 && len(a.Elements) > limit+truncatedTail && i == limit {
+			hidden := len(a.Elements) - limit - truncatedTail
+			elStrings = append(elStrings, fmt.Sprintf("... (%d more)", hidden))
+			for _, tail := range a.Elements[len(a.Elements)-truncatedTail:] {
+				elStrings = append(elStrings, inspectTruncated(tail, limit))
+			}
+			break
+		}
+		elStrings = append(elStrings, inspectTruncated(entry, limit))
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(elStrings, ", "))
+}
+
+// InspectTruncated is like Inspect but shortens the arrays among the hash's
+// values, at any depth, as Array.InspectTruncated does. Every pair is shown.
+func (h *Hash) InspectTruncated(limit int) string {
+	pairs := []string{}
+	for _, pair := range h.OrderedPairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspectTruncated(pair.Value, limit)))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+func inspectTruncated(obj Object, limit int) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.InspectTruncated(limit)
+	case *Hash:
+		return obj.InspectTruncated(limit)
+	default:
+		return obj.Inspect()
+	}
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -179,6 +307,13 @@ func (i *Integer) HashKey() HashKey {
 	}
 }
 
+func (n *Null) HashKey() HashKey {
+	return HashKey{
+		Type:  n.Type(),
+		Value: 0,
+	}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -196,15 +331,107 @@ type HashPair struct {
 
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	// order holds the keys of Pairs in the order Set first added them.
+	order []HashKey
+}
+
+// Set adds or replaces the pair stored under key. A new key goes after every
+// existing one; replacing a value keeps the key where it was.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if _, ok := h.Pairs[key]; !ok {
+		h.order = append(h.order, key)
+	}
+	h.Pairs[key] = pair
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.OrderedPairs() {
 		pairString := fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect())
 		pairs = append(pairs, pairString)
 	}
 
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
+
+// InspectIndented is like Inspect but puts each pair on its own line,
+// indenting nested arrays and hashes.
+func (h *Hash) InspectIndented() string {
+	return inspectIndented(h, 0)
+}
+
+// OrderedPairs returns the pairs in insertion order. Pairs written to the
+// Pairs map directly rather than through Set have no recorded position, so
+// they follow the rest sorted by key: grouped by type, then integers
+// numerically, strings lexically, and false before true.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	seen := make(map[HashKey]bool, len(h.order))
+	for _, key := range h.order {
+		if pair, ok := h.Pairs[key]; ok && !seen[key] {
+			seen[key] = true
+			pairs = append(pairs, pair)
+		}
+	}
+
+	unordered := []HashPair{}
+	for key, pair := range h.Pairs {
+		if !seen[key] {
+			unordered = append(unordered, pair)
+		}
+	}
+	sort.Slice(unordered, func(i, j int) bool {
+		return keyLess(unordered[i].Key, unordered[j].Key)
+	})
+
+	return append(pairs, unordered...)
+}
+
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return false
+	}
+}
+
+func inspectIndented(obj Object, depth int) string {
+	indent := strings.Repeat("  ", depth+1)
+	closing := strings.Repeat("  ", depth)
+
+	switch obj := obj.(type) {
+	case *Array:
+		if len(obj.Elements) == 0 {
+			return "[]"
+		}
+		lines := []string{}
+		for _, el := range obj.Elements {
+			lines = append(lines, indent+inspectIndented(el, depth+1))
+		}
+		return fmt.Sprintf("[\n%s\n%s]", strings.Join(lines, ",\n"), closing)
+	case *Hash:
+		if len(obj.Pairs) == 0 {
+			return "{}"
+		}
+		lines := []string{}
+		for _, pair := range obj.OrderedPairs() {
+			lines = append(lines, fmt.Sprintf("%s%s: %s", indent, pair.Key.Inspect(), inspectIndented(pair.Value, depth+1)))
+		}
+		return fmt.Sprintf("{\n%s\n%s}", strings.Join(lines, ",\n"), closing)
+	default:
+		return obj.Inspect()
+	}
+}
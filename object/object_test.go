@@ -20,3 +20,141 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestNullHashKey(t *testing.T) {
+	null1 := &Null{}
+	null2 := &Null{}
+
+	if null1.HashKey() != null2.HashKey() {
+		t.Errorf("nulls have different hash keys")
+	}
+
+	if null1.HashKey() == (&Integer{Value: 0}).HashKey() {
+		t.Errorf("null has the same hash key as integer 0")
+	}
+
+	if null1.HashKey() == (&Boolean{Value: false}).HashKey() {
+		t.Errorf("null has the same hash key as false")
+	}
+}
+
+func TestHashInspectIsSorted(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	keys := []Object{
+		&String{Value: "b"},
+		&Integer{Value: 10},
+		&Boolean{Value: true},
+		&String{Value: "a"},
+		&Integer{Value: -2},
+		&Boolean{Value: false},
+	}
+	for i, key := range keys {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: &Integer{Value: int64(i)}}
+	}
+
+	expected := "{false: 5, true: 2, -2: 4, 10: 1, a: 3, b: 0}"
+	for i := 0; i < 10; i++ {
+		if hash.Inspect() != expected {
+			t.Fatalf("hash.Inspect() wrong. want=%q, got=%q", expected, hash.Inspect())
+		}
+	}
+}
+
+func TestArrayInspectTruncated(t *testing.T) {
+	numbers := func(n int) *Array {
+		arr := &Array{}
+		for i := 0; i < n; i++ {
+			arr.Elements = append(arr.Elements, &Integer{Value: int64(i)})
+		}
+		return arr
+	}
+
+	tests := []struct {
+		array    *Array
+		limit    int
+		expected string
+	}{
+		{numbers(100000), 3, "[0, 1, 2, ... (99995 more), 99998, 99999]"},
+		{numbers(5), 3, "[0, 1, 2, 3, 4]"},
+		{numbers(6), 3, "[0, 1, 2, ... (1 more), 4, 5]"},
+		{numbers(6), 0, "[0, 1, 2, 3, 4, 5]"},
+		{&Array{Elements: []Object{numbers(10), &String{Value: "x"}}}, 2, "[[0, 1, ... (6 more), 8, 9], x]"},
+		{&Array{}, 3, "[]"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.array.InspectTruncated(tt.limit); got != tt.expected {
+			t.Errorf("InspectTruncated(%d) wrong. want=%q, got=%q", tt.limit, tt.expected, got)
+		}
+	}
+
+	if got := numbers(6).Inspect(); got != "[0, 1, 2, 3, 4, 5]" {
+		t.Errorf("Inspect() must not truncate. got=%q", got)
+	}
+
+	hash := &Hash{}
+	hash.Set((&String{Value: "a"}).HashKey(), HashPair{Key: &String{Value: "a"}, Value: numbers(200)})
+	hash.Set((&Integer{Value: 1}).HashKey(), HashPair{Key: &Integer{Value: 1}, Value: &Array{Elements: []Object{numbers(10)}}})
+	if got := hash.InspectTruncated(3); got != "{a: [0, 1, 2, ... (195 more), 198, 199], 1: [[0, 1, 2, ... (5 more), 8, 9]]}" {
+		t.Errorf("Hash.InspectTruncated(3) wrong. got=%q", got)
+	}
+	nested := &Array{Elements: []Object{hash}}
+	if got := nested.InspectTruncated(3); got != "[{a: [0, 1, 2, ... (195 more), 198, 199], 1: [[0, 1, 2, ... (5 more), 8, 9]]}]" {
+		t.Errorf("InspectTruncated(3) of a hash in an array wrong. got=%q", got)
+	}
+	if got := hash.InspectTruncated(0); got != hash.Inspect() {
+		t.Errorf("Hash.InspectTruncated(0) must not truncate. got=%q", got)
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := &Hash{}
+	set := func(key Hashable, value int64) {
+		hash.Set(key.HashKey(), HashPair{Key: key.(Object), Value: &Integer{Value: value}})
+	}
+
+	set(&String{Value: "b"}, 1)
+	set(&Integer{Value: 10}, 2)
+	set(&String{Value: "a"}, 3)
+	set(&String{Value: "b"}, 4)
+
+	expected := "{b: 4, 10: 2, a: 3}"
+	if hash.Inspect() != expected {
+		t.Fatalf("hash.Inspect() wrong. want=%q, got=%q", expected, hash.Inspect())
+	}
+
+	// pairs added without Set come last, sorted
+	for _, name := range []string{"z", "c"} {
+		key := &String{Value: name}
+		hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: 0}}
+	}
+	expected = "{b: 4, 10: 2, a: 3, c: 0, z: 0}"
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. want=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+func TestInspectIndented(t *testing.T) {
+	inner := &Hash{Pairs: map[HashKey]HashPair{}}
+	for i, name := range []string{"y", "x"} {
+		key := &String{Value: name}
+		inner.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: int64(i)}}
+	}
+	array := &Array{Elements: []Object{&Integer{Value: 1}, inner, &Array{}}}
+
+	expected := `[
+  1,
+  {
+    x: 1,
+    y: 0
+  },
+  []
+]`
+	if array.InspectIndented() != expected {
+		t.Errorf("array.InspectIndented() wrong. want=%q, got=%q", expected, array.InspectIndented())
+	}
+
+	if array.Inspect() != "[1, {x: 1, y: 0}, []]" {
+		t.Errorf("array.Inspect() wrong. got=%q", array.Inspect())
+	}
+}
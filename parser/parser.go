@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/hudsn/learn-interpreter/ast"
 	"github.com/hudsn/learn-interpreter/lexer"
@@ -12,26 +13,42 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // =
+	COALESCE    // ??
+	PIPE        // |>
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
 	EQUALS      // ==
 	LESSGREATER // > or <
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
-	PREFIX      // -X or !X
+	PREFIX      // -X, +X or !X
 	CALL        // myfunction(x)
 	INDEX
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:            ASSIGN,
+	token.COALESCE:          COALESCE,
+	token.PIPE:              PIPE,
+	token.EQ:                EQUALS,
+	token.NOT_EQ:            EQUALS,
+	token.LT:                LESSGREATER,
+	token.GT:                LESSGREATER,
+	token.BIT_OR:            BIT_OR,
+	token.BIT_XOR:           BIT_XOR,
+	token.BIT_AND:           BIT_AND,
+	token.SHIFT_LEFT:        SHIFT,
+	token.SHIFT_RIGHT:       SHIFT,
+	token.PLUS:              SUM,
+	token.MINUS:             SUM,
+	token.SLASH:             PRODUCT,
+	token.ASTERISK:          PRODUCT,
+	token.LPAREN:            CALL,
+	token.LBRACKET:          INDEX,
+	token.OPTIONAL_LBRACKET: INDEX,
 }
 
 type (
@@ -66,13 +83,18 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.TRUE, p.parseBool)
 	p.registerPrefix(token.FALSE, p.parseBool)
+	p.registerPrefix(token.NULL, p.parseNull)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
+	p.registerPrefix(token.ERROR, p.parseLexerError)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.PLUS, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionExpression)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
@@ -85,8 +107,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.COALESCE, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_LBRACKET, p.parseIndexExpression)
 	// call twice so that cur and peek are both set
 	p.nextToken()
 	p.nextToken()
@@ -99,6 +130,15 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			hash.Order = append(hash.Order, p.parseSpreadExpression())
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			continue
+		}
+
 		key := p.parseExpression(LOWEST)
 
 		if !p.expectPeek(token.COLON) {
@@ -109,6 +149,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		val := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = val
+		hash.Order = append(hash.Order, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -141,8 +182,19 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
+		before := len(p.errors)
 		stmt := p.parseStatement()
-		if stmt != nil {
+
+		if len(p.errors) > before {
+			// Only the first error of a broken statement is kept; the rest
+			// are usually knock-on effects of it.
+			p.errors = p.errors[:before+1]
+			if len(p.errors) >= maxErrors {
+				p.errors = append(p.errors, "too many errors")
+				break
+			}
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -151,12 +203,46 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// maxErrors is how many errors ParseProgram reports before giving up.
+const maxErrors = 10
+
+// statementStarts are the tokens synchronize treats as the start of a new statement.
+var statementStarts = map[token.TokenType]bool{
+	token.LET:    true,
+	token.CONST:  true,
+	token.RETURN: true,
+	token.SWITCH: true,
+}
+
+// synchronize skips the rest of a statement that failed to parse, stopping
+// on its semicolon or just before the next statement keyword, so parsing
+// can resume cleanly and report later errors too.
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
+		if statementStarts[p.peekToken.Type] || p.peekTokenIs(token.EOF) {
+			return
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
+	case token.SEMICOLON:
+		// Semicolons only separate statements, so a stray or repeated one is
+		// an empty statement rather than an error.
+		return nil
 	case token.LET:
+		if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+			return p.parseDestructuringLetStatement()
+		}
 		return p.parseLetStatement()
+	case token.CONST:
+		return p.parseConstStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.SWITCH:
+		return p.parseSwitchStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -210,6 +296,52 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses the right side at LOWEST so that assignment
+// is right associative: a[0] = b[0] = 1 sets both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.curToken, Target: target}
+
+	if target == nil {
+		return nil
+	}
+	switch target := target.(type) {
+	case *ast.Identifier:
+	case *ast.IndexExpression:
+		if target.Optional {
+			p.errors = append(p.errors, fmt.Sprintf("invalid assignment target %s", target.String()))
+			return nil
+		}
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("invalid assignment target %s", target.String()))
+		return nil
+	}
+
+	p.nextToken()
+
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
+// parsePipeExpression rewrites x |> f into the call f(x), and x |> f(a) into
+// f(x, a), so the evaluator only ever sees ordinary calls.
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	precedence := p.curPrecedence()
+	p.nextToken()
+
+	right := p.parseExpression(precedence)
+	if right == nil {
+		return nil
+	}
+
+	if call, ok := right.(*ast.CallExpression); ok {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+	return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal}
 
@@ -254,6 +386,16 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			elseIf, ok := p.parseIfExpression().(*ast.IfExpression)
+			if !ok {
+				return nil
+			}
+			expression.ElseIf = elseIf
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -264,48 +406,160 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.CodeParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
 func (p *Parser) parseFunctionExpression() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Variadic = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
 	lit.Body = p.parseBlockStatement()
+	markTailCalls(lit.Body, true, true)
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// markTailCalls flags the calls in block whose result is the function's result.
+// tail says whether the block's own value is returned, and returns says whether
+// return statements inside it leave the function directly (they don't inside a
+// try block, where the error must still be caught). Nested function literals
+// are marked separately when they are parsed.
+func markTailCalls(block *ast.BlockStatement, tail bool, returns bool) {
+	if block == nil {
+		return
+	}
+
+	for i, stmt := range block.Statements {
+		isTail := tail && i == len(block.Statements)-1
+
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.ReturnValue, returns, returns)
+		case *ast.ExpressionStatement:
+			markTailExpression(stmt.Expression, isTail, returns)
+		case *ast.SwitchStatement:
+			for _, clause := range stmt.Cases {
+				markTailCalls(clause.Body, isTail, returns)
+			}
+			markTailCalls(stmt.Default, isTail, returns)
+		}
+	}
+}
+
+func markTailExpression(exp ast.Expression, tail bool, returns bool) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		exp.Tail = tail
+	case *ast.IfExpression:
+		markTailCalls(exp.Consequence, tail, returns)
+		markTailCalls(exp.Alternative, tail, returns)
+		if exp.ElseIf != nil {
+			markTailExpression(exp.ElseIf, tail, returns)
+		}
+	case *ast.TryExpression:
+		markTailCalls(exp.Block, false, false)
+		markTailCalls(exp.Handler, tail, returns)
+	}
+}
+
+// parseFunctionParameters also reports whether the final parameter was declared
+// as a rest parameter with a leading "...". A parameter may be followed by
+// "= expr" to give it a default; once one parameter has a default, every
+// later one except the rest parameter needs one too.
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, bool) {
 	identifiers := []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return identifiers, false
 	}
 
-	p.nextToken()
-
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
-
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+	variadic := false
+	for {
 		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			variadic = true
+			p.nextToken()
+		}
+
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.parseAnnotation(ident) {
+			return nil, false
+		}
+		if p.peekTokenIs(token.ASSIGN) {
+			if variadic {
+				p.errors = append(p.errors, fmt.Sprintf("rest parameter %s cannot have a default", ident.Value))
+				return nil, false
+			}
+			p.nextToken()
+			p.nextToken()
+			ident.Default = p.parseExpression(ASSIGN)
+			if ident.Default == nil {
+				return nil, false
+			}
+		} else if !variadic && len(identifiers) > 0 && identifiers[len(identifiers)-1].Default != nil {
+			p.errors = append(p.errors, fmt.Sprintf("parameter %s without a default follows a parameter with one", ident.Value))
+			return nil, false
+		}
 		identifiers = append(identifiers, ident)
+
+		if variadic || !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, false
 	}
 
-	return identifiers
+	return identifiers, variadic
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -333,7 +587,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(array ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: array}
+	exp := &ast.IndexExpression{Token: p.curToken, Left: array, Optional: p.curTokenIs(token.OPTIONAL_LBRACKET)}
 	if p.peekTokenIs(token.RBRACKET) {
 		return nil
 	}
@@ -361,12 +615,16 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 	p.nextToken()
 
-	items := []ast.Expression{p.parseExpression(LOWEST)}
+	items := []ast.Expression{p.parseListItem()}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		// a trailing comma before the closing token is allowed
+		if p.peekTokenIs(end) {
+			break
+		}
 		p.nextToken()
-		items = append(items, p.parseExpression(LOWEST))
+		items = append(items, p.parseListItem())
 	}
 
 	if !p.expectPeek(end) {
@@ -376,6 +634,22 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return items
 }
 
+// parseListItem parses one element of an array literal or argument list,
+// which may be spread with a leading ...
+func (p *Parser) parseListItem() ast.Expression {
+	if p.curTokenIs(token.ELLIPSIS) {
+		return p.parseSpreadExpression()
+	}
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -388,6 +662,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.parseAnnotation(stmt.Name) {
+		return nil
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -402,9 +679,152 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// parseAnnotation records an optional ": Type" after ident. It reports false
+// if a colon is not followed by a type name.
+func (p *Parser) parseAnnotation(ident *ast.Identifier) bool {
+	if !p.peekTokenIs(token.COLON) {
+		return true
+	}
+	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return false
+	}
+	ident.Annotation = p.curToken.Literal
+	return true
+}
+
+func (p *Parser) parseDestructuringLetStatement() ast.Statement {
+	stmt := &ast.DestructuringLetStatement{Token: p.curToken}
+
+	p.nextToken()
+	var end token.TokenType = token.RBRACKET
+	if p.curTokenIs(token.LBRACE) {
+		stmt.FromHash = true
+		end = token.RBRACE
+	}
+
+	for !p.peekTokenIs(end) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if !p.peekTokenIs(end) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if len(stmt.Names) == 0 {
+		p.errors = append(p.errors, "destructuring let must bind at least one name")
+		return nil
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseConstStatement shares the let grammar: const <ident> = <expression>;
+func (p *Parser) parseConstStatement() ast.Statement {
+	let := p.parseLetStatement()
+	if let == nil {
+		return nil
+	}
+	return &ast.ConstStatement{Token: let.Token, Name: let.Name, Value: let.Value}
+}
+
+func (p *Parser) parseSwitchStatement() ast.Statement {
+	stmt := &ast.SwitchStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) {
+		switch p.curToken.Type {
+		case token.CASE:
+			clause := &ast.CaseClause{Token: p.curToken}
+			p.nextToken()
+			clause.Value = p.parseExpression(LOWEST)
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			clause.Body = p.parseCaseBody()
+			stmt.Cases = append(stmt.Cases, clause)
+		case token.DEFAULT:
+			if stmt.Default != nil {
+				p.errors = append(p.errors, "switch statement has more than one default case")
+				return nil
+			}
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			stmt.Default = p.parseCaseBody()
+		default:
+			msg := fmt.Sprintf("expected case or default in switch statement, got %s instead", p.curToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseCaseBody collects statements up to the next case, default, or the
+// closing brace of the switch, leaving that token as the current one.
+func (p *Parser) parseCaseBody() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.CASE) && !p.curTokenIs(token.DEFAULT) &&
+		!p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	return block
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
+	// a bare return leaves ReturnValue nil and evaluates to null. Without a
+	// semicolon it ends wherever the next statement keyword starts.
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) ||
+		p.peekStartsStatement() {
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
@@ -416,10 +836,22 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// peekStartsStatement reports whether the next token can only begin a new
+// statement, never continue an expression.
+func (p *Parser) peekStartsStatement() bool {
+	switch p.peekToken.Type {
+	case token.LET, token.CONST, token.RETURN, token.SWITCH:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	digits := strings.ReplaceAll(p.curToken.Literal, "_", "")
+	value, err := strconv.ParseInt(digits, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
 		p.errors = append(p.errors, msg)
@@ -435,6 +867,25 @@ func (p *Parser) parseBool() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
+// parseLexerError reports an ERROR token, whose literal is already a
+// complete message from the lexer.
+func (p *Parser) parseLexerError() ast.Expression {
+	p.errors = append(p.errors, p.curToken.Literal)
+	return nil
+}
+
+// parseIllegal reports tokens the lexer could not make sense of, such as an
+// integer literal with digits outside its base.
+func (p *Parser) parseIllegal() ast.Expression {
+	msg := fmt.Sprintf("illegal token %q", p.curToken.Literal)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
 	p.errors = append(p.errors, msg)
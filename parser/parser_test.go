@@ -3,10 +3,13 @@ package parser
 import (
 	"fmt"
 	"log"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hudsn/learn-interpreter/ast"
 	"github.com/hudsn/learn-interpreter/lexer"
+	"github.com/hudsn/learn-interpreter/token"
 )
 
 func TestParsingHashLiteralsWithExpressions(t *testing.T) {
@@ -46,9 +49,9 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 			continue
 		}
 
-		testFunc, ok := tests[literal.String()]
+		testFunc, ok := tests[literal.Value]
 		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
+			t.Errorf("No test function for key %q found", literal.Value)
 			continue
 		}
 
@@ -56,6 +59,36 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingHashLiteralComputedKeys(t *testing.T) {
+	input := `{"a" + "b": 1, 2 * 3: "x"}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for key := range hash.Pairs {
+		infix, ok := key.(*ast.InfixExpression)
+		if !ok {
+			t.Errorf("key is not ast.InfixExpression. got=%T", key)
+			continue
+		}
+		if infix.Operator != "+" && infix.Operator != "*" {
+			t.Errorf("unexpected key operator %q", infix.Operator)
+		}
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -105,7 +138,7 @@ func TestParsingHashLiteralStringKeys(t *testing.T) {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 		}
 
-		expectedValue := expected[literal.String()]
+		expectedValue := expected[literal.Value]
 
 		testIntegerLiteral(t, value, expectedValue)
 	}
@@ -140,6 +173,77 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingOptionalIndexExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`user?["address"]`, `(user?["address"])`},
+		{`user?["address"]?["city"]`, `((user?["address"])?["city"])`},
+		{`user["address"]?["city"]`, `((user["address"])?["city"])`},
+		{`a?[0] ?? 1`, `((a?[0]) ?? 1)`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong parse for %q. want=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestParsingIndexAssignment(t *testing.T) {
+	input := "grid[1][2] = x + 1"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statments is wrong length. wanted=%d, got=%d", 1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	assign, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+	}
+
+	if assign.Target.String() != "((grid[1])[2])" {
+		t.Errorf("assign.Target wrong. got=%q", assign.Target.String())
+	}
+
+	if !testInfixExpression(t, assign.Value, "x", "+", 1) {
+		return
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []string{
+		"x + 1 = 2",
+		"1 + a[0] = 2",
+		"f() = 1",
+		"a?[0] = 1",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestArrayLiteralExpression(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -175,6 +279,73 @@ func TestArrayLiteralExpression(t *testing.T) {
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
 }
 
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"[1,\n 2,\n]", "[1, 2]"},
+		{`{"a": 1,}`, `{"a": 1}`},
+		{"add(1, 2,)", "add(1, 2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{"[1,,]", "[,]", `{"a": 1,,}`, `{,}`} {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[...a, 4, ...b]", "[...a, 4, ...b]"},
+		{"[...f(x)[0]]", "[...(f(x)[0])]"},
+		{`{...base, "k": 1, ...extra}`, `{...base, "k": 1, ...extra}`},
+		{`{...h,}`, "{...h}"},
+		{"add(...args)", "add(...args)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{"[...]", `{...h: 1}`, "{... }"} {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world"`
 
@@ -274,6 +445,193 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestVariadicFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		variadic       bool
+		expectedString string
+	}{
+		{"fn(...rest) {};", []string{"rest"}, true, "fn(...rest) {}"},
+		{"fn(a, b, ...rest) {};", []string{"a", "b", "rest"}, true, "fn(a, b, ...rest) {}"},
+		{"fn(a, b) {};", []string{"a", "b"}, false, "fn(a, b) {}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+
+		if function.Variadic != tt.variadic {
+			t.Errorf("function.Variadic wrong. want=%t, got=%t", tt.variadic, function.Variadic)
+		}
+
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. want=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestVariadicParameterMustBeLast(t *testing.T) {
+	l := lexer.New("fn(...rest, a) {};")
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors for a rest parameter that is not last")
+	}
+}
+
+func TestDefaultParameterParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedDefaults []string
+		expectedString   string
+	}{
+		{"fn(a, b = 10) {};", []string{"", "10"}, "fn(a, b = 10) {}"},
+		{"fn(a = 1 + 2, b = a) {};", []string{"(1 + 2)", "a"}, "fn(a = (1 + 2), b = a) {}"},
+		{"fn(a: Int = 1, ...rest) {};", []string{"1", ""}, "fn(a: Int = 1, ...rest) {}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedDefaults) {
+			t.Fatalf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedDefaults), len(function.Parameters))
+		}
+
+		for i, want := range tt.expectedDefaults {
+			got := ""
+			if function.Parameters[i].Default != nil {
+				got = function.Parameters[i].Default.String()
+			}
+			if got != want {
+				t.Errorf("parameter %d has wrong default. want=%q, got=%q", i, want, got)
+			}
+		}
+
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. want=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestDefaultParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) {};", "parameter b without a default follows a parameter with one"},
+		{"fn(...rest = []) {};", "rest parameter rest cannot have a default"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestTailCallMarking(t *testing.T) {
+	input := `fn(n) {
+		a(1);
+		if (n) { return b(c(2)); }
+		let x = d();
+		try { return e(); } catch (err) { return f(); }
+		switch (n) { case 1: g() default: h() }
+		fn() { i(); j() };
+		if (n) { k() } else if (n) { l() } else { m() }
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := map[string]bool{
+		"a": false, "b": true, "c": false, "d": false, "e": false, "f": true,
+		"g": false, "h": false, "i": false, "j": true, "k": true, "l": true, "m": true,
+	}
+
+	calls := map[string]*ast.CallExpression{}
+	var collect func(node interface{})
+	collect = func(node interface{}) {
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+			if node == nil {
+				return
+			}
+			for _, stmt := range node.Statements {
+				collect(stmt)
+			}
+		case *ast.ExpressionStatement:
+			collect(node.Expression)
+		case *ast.ReturnStatement:
+			collect(node.ReturnValue)
+		case *ast.LetStatement:
+			collect(node.Value)
+		case *ast.SwitchStatement:
+			for _, clause := range node.Cases {
+				collect(clause.Body)
+			}
+			collect(node.Default)
+		case *ast.IfExpression:
+			collect(node.Consequence)
+			collect(node.Alternative)
+			if node.ElseIf != nil {
+				collect(node.ElseIf)
+			}
+		case *ast.TryExpression:
+			collect(node.Block)
+			collect(node.Handler)
+		case *ast.FunctionLiteral:
+			collect(node.Body)
+		case *ast.CallExpression:
+			calls[node.Function.String()] = node
+			for _, arg := range node.Arguments {
+				collect(arg)
+			}
+		}
+	}
+	collect(program.Statements[0])
+
+	for name, tail := range expected {
+		call, ok := calls[name]
+		if !ok {
+			t.Errorf("call to %s not found", name)
+			continue
+		}
+		if call.Tail != tail {
+			t.Errorf("call to %s has wrong Tail. want=%t, got=%t", name, tail, call.Tail)
+		}
+	}
+}
+
 func TestFunctionExpression(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 	l := lexer.New(input)
@@ -418,17 +776,194 @@ func TestIfElseExpression(t *testing.T) {
 			t.Fatalf("exp.Alternative.Statements was nil")
 		}
 
-		if len(exp.Alternative.Statements) != 1 {
-			t.Errorf("alternative is not 1 statements. got=%d\n", len(exp.Alternative.Statements))
-		}
+		if len(exp.Alternative.Statements) != 1 {
+			t.Errorf("alternative is not 1 statements. got=%d\n", len(exp.Alternative.Statements))
+		}
+
+		alt, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("exp.Alternative.Statements[0] is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
+		}
+
+		if !testIdentifier(t, alt.Expression, "y") {
+			return
+		}
+	}
+}
+
+func TestElseIfChain(t *testing.T) {
+	input := "if (a) { x } else if (b) { y } else { z }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", 1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	first, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, first.Condition, "a") {
+		return
+	}
+	if first.Alternative != nil {
+		t.Fatalf("first.Alternative should be nil when chaining. got=%v", first.Alternative)
+	}
+	if first.ElseIf == nil {
+		t.Fatalf("first.ElseIf was nil")
+	}
+
+	second := first.ElseIf
+	if !testIdentifier(t, second.Condition, "b") {
+		return
+	}
+	if second.ElseIf != nil {
+		t.Fatalf("second.ElseIf should be nil. got=%v", second.ElseIf)
+	}
+	if second.Alternative == nil || len(second.Alternative.Statements) != 1 {
+		t.Fatalf("second.Alternative should hold 1 statement. got=%v", second.Alternative)
+	}
+
+	alt := second.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, alt.Expression, "z") {
+		return
+	}
+
+	expected := "if (a) { x } else if (b) { y } else { z }"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. want=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := "try { x } catch (err) { err }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", 1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt is not ast.TryExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Block.Statements) != 1 {
+		t.Errorf("try block is not 1 statements. got=%d", len(exp.Block.Statements))
+	}
+	if !testIdentifier(t, exp.Param, "err") {
+		return
+	}
+	if len(exp.Handler.Statements) != 1 {
+		t.Errorf("catch block is not 1 statements. got=%d", len(exp.Handler.Statements))
+	}
+	if exp.CodeParam != nil {
+		t.Errorf("exp.CodeParam is not nil. got=%s", exp.CodeParam)
+	}
+}
+
+func TestTryExpressionWithCodeParam(t *testing.T) {
+	input := "try { x } catch (err, code) { code }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt is not ast.TryExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Param, "err") {
+		return
+	}
+	if !testIdentifier(t, exp.CodeParam, "code") {
+		return
+	}
+}
+
+func TestSwitchStatement(t *testing.T) {
+	input := `switch (x) {
+	case 1: a; b
+	case "two":
+		c;
+	default: d
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.SwitchStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.SwitchStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Subject, "x") {
+		return
+	}
+
+	if len(stmt.Cases) != 2 {
+		t.Fatalf("switch does not have 2 cases. got=%d", len(stmt.Cases))
+	}
+
+	testIntegerLiteral(t, stmt.Cases[0].Value, 1)
+	if len(stmt.Cases[0].Body.Statements) != 2 {
+		t.Errorf("first case does not have 2 statements. got=%d", len(stmt.Cases[0].Body.Statements))
+	}
+
+	if stmt.Cases[1].Value.String() != `"two"` {
+		t.Errorf("second case value is not %q. got=%q", `"two"`, stmt.Cases[1].Value.String())
+	}
+	if len(stmt.Cases[1].Body.Statements) != 1 {
+		t.Errorf("second case does not have 1 statement. got=%d", len(stmt.Cases[1].Body.Statements))
+	}
+
+	if stmt.Default == nil {
+		t.Fatalf("switch default was nil")
+	}
+	if len(stmt.Default.Statements) != 1 {
+		t.Errorf("default does not have 1 statement. got=%d", len(stmt.Default.Statements))
+	}
+
+	expected := `switch (x) {case 1: a; b;case "two": c;default: d;}`
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. want=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestSwitchStatementErrors(t *testing.T) {
+	tests := []string{
+		"switch (x) { default: 1 default: 2 }",
+		"switch (x) { 1 }",
+		"switch (x) { case 1: 1",
+	}
 
-		alt, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
-		if !ok {
-			t.Fatalf("exp.Alternative.Statements[0] is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
-		}
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
 
-		if !testIdentifier(t, alt.Expression, "y") {
-			return
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
 		}
 	}
 }
@@ -488,6 +1023,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"--5",
+			"(-(-5))",
+		},
+		{
+			"-+5",
+			"(-(+5))",
+		},
+		{
+			"a - +b * c",
+			"(a - ((+b) * c))",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -514,7 +1061,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4); ((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -584,6 +1131,66 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"a << 1 + 2 < b >> c",
+			"((a << (1 + 2)) < (b >> c))",
+		},
+		{
+			"a & b & c",
+			"((a & b) & c)",
+		},
+		{
+			"1 << 2 << 3",
+			"((1 << 2) << 3)",
+		},
+		{
+			"a[0] = b[0] = 1 + 2",
+			"((a[0]) = ((b[0]) = (1 + 2)))",
+		},
+		{
+			"x = y = a * b",
+			"(x = (y = (a * b)))",
+		},
+		{
+			"a ?? b | c == d",
+			"(a ?? (b | (c == d)))",
+		},
+		{
+			"x = a ?? b ?? c",
+			"(x = ((a ?? b) ?? c))",
+		},
+		{
+			"x |> f",
+			"f(x)",
+		},
+		{
+			"x |> f(a, b)",
+			"f(x, a, b)",
+		},
+		{
+			"a + 1 |> f |> g(2)",
+			"g(f((a + 1)), 2)",
+		},
+		{
+			"x |> fn(y) { y }",
+			"fn(y) { y }(x)",
+		},
+		{
+			"a | b |> f",
+			"f((a | b))",
+		},
+		{
+			"y = x |> f",
+			"(y = f(x))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -613,6 +1220,12 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"5 ?? 5;", 5, "??", 5},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -648,6 +1261,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5", "!", 5},
 		{"-15", "-", 15},
+		{"+15", "+", 15},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
 	}
@@ -714,6 +1328,123 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestRadixIntegerLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"0x7FFFFFFFFFFFFFFF", 9223372036854775807},
+		{"0b111111111111111111111111111111111111111111111111111111111111111", 9223372036854775807},
+		{"42", 42},
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 65535},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+}
+
+func TestIllegalTokenError(t *testing.T) {
+	l := lexer.New("0b102")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 parser error. got=%d (%v)", len(errors), errors)
+	}
+	if errors[0] != `illegal token "0b102"` {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `let = 5;
+let x = 1;
+let y 2;
+x + ;
+let z = 3
+return )`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"expected next token to be IDENT, got = instead",
+		"expected next token to be =, got INT instead",
+		"no prefix parse function for ; found",
+		"no prefix parse function for ) found",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%q)", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements wrong length. want=2, got=%d", len(program.Statements))
+	}
+	for i, name := range []string{"x", "z"} {
+		if !testLetStatement(t, program.Statements[i], name) {
+			return
+		}
+	}
+}
+
+func TestParserErrorLimit(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", 20)
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != maxErrors+1 {
+		t.Fatalf("wrong number of errors. want=%d, got=%d", maxErrors+1, len(errors))
+	}
+	if errors[maxErrors] != "too many errors" {
+		t.Errorf("last error wrong. got=%q", errors[maxErrors])
+	}
+}
+
+func TestLexerErrorReported(t *testing.T) {
+	l := lexer.New(`let s = "\xZZ";`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 parser error. got=%d (%v)", len(errors), errors)
+	}
+	if errors[0] != `invalid escape sequence "\\x" at line 1, column 10` {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 	lexer := lexer.New(input)
@@ -785,6 +1516,47 @@ func TestReturnStatements(t *testing.T) {
 
 }
 
+func TestBareReturnStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedString string
+	}{
+		{"return;", "return;"},
+		{"return", "return;"},
+		{"return x;", "return x;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+		if returnStmt.String() != tt.expectedString {
+			t.Errorf("returnStmt.String() wrong. want=%q, got=%q", tt.expectedString, returnStmt.String())
+		}
+	}
+
+	l := lexer.New("fn() { return }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	returnStmt := fn.Body.Statements[0].(*ast.ReturnStatement)
+	if returnStmt.ReturnValue != nil {
+		t.Errorf("returnStmt.ReturnValue is not nil. got=%v", returnStmt.ReturnValue)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -819,6 +1591,178 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestOptionalSemicolons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1 let y = 2", []string{"let x = 1;", "let y = 2;"}},
+		{"let x = 1; let y = 2;", []string{"let x = 1;", "let y = 2;"}},
+		{"let x = 1\nlet y = 2\nx; y", []string{"let x = 1;", "let y = 2;", "x", "y"}},
+		{"const x = 1 return x", []string{"const x = 1;", "return x;"}},
+		{"let [a, b] = [1, 2] a", []string{"let [a, b] = [1, 2];", "a"}},
+		{"x = 1 y = 2", []string{"(x = 1)", "(y = 2)"}},
+		{"let f = fn() { 1 } f()", []string{"let f = fn() { 1 };", "f()"}},
+		{"switch (x) { case 1: 2 } 3", []string{"switch (x) {case 1: 2;}", "3"}},
+		{"return return", []string{"return;", "return;"}},
+		{";;let x = 1;;; x;", []string{"let x = 1;", "x"}},
+		{";", []string{}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != len(tt.expected) {
+			t.Errorf("wrong number of statements for %q. want=%d, got=%d",
+				tt.input, len(tt.expected), len(program.Statements))
+			continue
+		}
+		for i, stmt := range program.Statements {
+			if stmt.String() != tt.expected[i] {
+				t.Errorf("statement %d of %q is wrong. want=%q, got=%q",
+					i, tt.input, tt.expected[i], stmt.String())
+			}
+		}
+	}
+}
+
+func TestEmptyStatementsInBlocks(t *testing.T) {
+	p := New(lexer.New("fn() { ; 1;; 2; }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 2 {
+		t.Fatalf("function body has wrong number of statements. want=2, got=%d",
+			len(fn.Body.Statements))
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	input := `let x: Int = 5;
+const name: String = "monkey";
+let add = fn(a: Int, b, ...rest: Array) { a };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Name.Value != "x" || let.Name.Annotation != "Int" {
+		t.Errorf("wrong let name. got value=%q annotation=%q", let.Name.Value, let.Name.Annotation)
+	}
+
+	constant := program.Statements[1].(*ast.ConstStatement)
+	if constant.Name.Annotation != "String" {
+		t.Errorf("wrong const annotation. got=%q", constant.Name.Annotation)
+	}
+
+	fn := program.Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	want := []string{"Int", "", "Array"}
+	for i, param := range fn.Parameters {
+		if param.Annotation != want[i] {
+			t.Errorf("parameter %d has wrong annotation. want=%q, got=%q", i, want[i], param.Annotation)
+		}
+	}
+
+	expected := `let x: Int = 5;const name: String = "monkey";let add = fn(a: Int, b, ...rest: Array) { a };`
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+
+	for _, input := range []string{"let x: = 5;", "let x: 5 = 5;", "fn(a:) { a }"} {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedNames []string
+		fromHash      bool
+		expected      string
+	}{
+		{"let [a, b] = pair();", []string{"a", "b"}, false, "let [a, b] = pair();"},
+		{"let [x] = [1]", []string{"x"}, false, "let [x] = [1];"},
+		{"let {x, y,} = point;", []string{"x", "y"}, true, "let {x, y} = point;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.DestructuringLetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.DestructuringLetStatement. got=%T", program.Statements[0])
+		}
+		if len(stmt.Names) != len(tt.expectedNames) {
+			t.Fatalf("wrong number of names. want=%d, got=%d", len(tt.expectedNames), len(stmt.Names))
+		}
+		for i, name := range tt.expectedNames {
+			testIdentifier(t, stmt.Names[i], name)
+		}
+		if stmt.FromHash != tt.fromHash {
+			t.Errorf("stmt.FromHash wrong. want=%t, got=%t", tt.fromHash, stmt.FromHash)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	for _, input := range []string{"let [] = x", "let [a, 1] = x", "let {a b} = x", "let [a, b]"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	input := "const x = 5 + 1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ConstStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ConstStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.TokenLiteral() != "const" {
+		t.Errorf("stmt.TokenLiteral not 'const'. got=%q", stmt.TokenLiteral())
+	}
+	if !testIdentifier(t, stmt.Name, "x") {
+		return
+	}
+	testInfixExpression(t, stmt.Value, 5, "+", 1)
+
+	if stmt.String() != "const x = (5 + 1);" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -949,3 +1893,120 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, ope
 
 	return true
 }
+
+// TestStringRoundTrip checks that program.String() is source for the same
+// program: parsing it again must give a structurally equal AST.
+func TestStringRoundTrip(t *testing.T) {
+	corpus := []string{
+		`let x = 5; let y = x; y`,
+		`let x: Int = 1; const name: String = "monkey"`,
+		`let [a, b] = [1, 2]; let {x, y} = {"x": 1, "y": 2}`,
+		`-a * b; !-a; +x; !!true; -(-5)`,
+		`a + b * c - d / e; (a + b) * c; 1 < 2 == 3 > 4 != false`,
+		`a & b | c ^ d << e >> f`,
+		`a ?? b ?? c; x |> f |> g(1, 2)`,
+		`0x1F + 0b101 + 0o17 + 1_000`,
+		`"plain"; "quote \" and \\ backslash"; "tab\tnew\nline"; "\x01\x7f"; "héllo 世界"`,
+		`x = 1; a[0] = b["k"] = 2; (x = 3) + 1; f(x = 4)`,
+		`let f = fn(x, y) { x + y }; f(1, 2)`,
+		`fn() {}; fn(a, ...rest) { rest }; fn(a: Int) { return a; }; fn() { return }`,
+		`fn(x) { x }(5); (fn(x) { x })(5)`,
+		`fn(a, b = 10, c: Int = a * 2, ...rest) { a }; fn(x = fn(y = 1) { y }) { x }`,
+		`let fact = fn(n) { if (n < 2) { return 1 } fact(n - 1) * n }`,
+		`if (x) { 1 }; if (x < y) { x } else { y }; if (a) { 1 } else if (b) { 2 } else { 3 }`,
+		`if (true) {} else {}`,
+		`try { risky() } catch (e) { e }; try { 1 } catch (e, code) { code }`,
+		`switch (x) { case 1: a; b case "two": c default: d }; 3`,
+		`switch (x) { case 1: 1 }`,
+		`[1, [2, 3], []]; [...xs, 4, ...ys]; f(...args)`,
+		`{}; {"a": 1, 2: [3], true: {"n": null}}; {...base, "k": 1}`,
+		`a[1][2]; a?["b"]?[0]; f(x)[0](y)`,
+		`null; true; false`,
+		`puts(1) puts(2); let z = 3 z`,
+		`f
+(x)`,
+		`let g = fn() { let a = 1; a; fn() { a } }`,
+	}
+
+	for _, input := range corpus {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		printed := program.String()
+		rp := New(lexer.New(printed))
+		reparsed := rp.ParseProgram()
+		if len(rp.Errors()) != 0 {
+			t.Errorf("String() of %q does not parse: %q gives %v", input, printed, rp.Errors())
+			continue
+		}
+
+		if !astEqual(reflect.ValueOf(program), reflect.ValueOf(reparsed)) {
+			t.Errorf("String() of %q parses into a different program: %q became %q",
+				input, printed, reparsed.String())
+		}
+	}
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// astEqual compares two AST values field by field, ignoring tokens, whose
+// positions and spelling legitimately differ between source and String().
+// Hash literal pairs are keyed by node pointers, so they are compared through
+// Order instead.
+func astEqual(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return astEqual(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !astEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if hash, ok := a.Addr().Interface().(*ast.HashLiteral); ok {
+			return hashLiteralsEqual(hash, b.Addr().Interface().(*ast.HashLiteral))
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).Type == tokenType {
+				continue
+			}
+			if !astEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
+
+func hashLiteralsEqual(a, b *ast.HashLiteral) bool {
+	if len(a.Order) != len(b.Order) {
+		return false
+	}
+	for i := range a.Order {
+		if !astEqual(reflect.ValueOf(&a.Order[i]).Elem(), reflect.ValueOf(&b.Order[i]).Elem()) {
+			return false
+		}
+		if _, ok := a.Order[i].(*ast.SpreadExpression); ok {
+			continue
+		}
+		if !astEqual(reflect.ValueOf(a.Pairs[a.Order[i]]), reflect.ValueOf(b.Pairs[b.Order[i]])) {
+			return false
+		}
+	}
+	return true
+}
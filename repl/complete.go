@@ -0,0 +1,83 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hudsn/learn-interpreter/evaluator"
+	"github.com/hudsn/learn-interpreter/object"
+	"github.com/hudsn/learn-interpreter/token"
+)
+
+// completionNames is everything an identifier at the prompt could refer to:
+// builtins, bindings in env, and keywords.
+func completionNames(ev *evaluator.Evaluator, env *object.Environment) []string {
+	seen := make(map[string]bool)
+	for name := range ev.Builtins() {
+		seen[name] = true
+	}
+	for _, name := range env.Names() {
+		seen[name] = true
+	}
+	for _, word := range token.Keywords() {
+		seen[word] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// complete extends the identifier at the end of line as far as the names
+// starting with it agree, and returns those names. Matching is by prefix
+// only; where the identifier appears in the line doesn't matter.
+func complete(line string, names []string) (string, []string) {
+	start := len(line)
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	word := line[start:]
+
+	candidates := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return line, nil
+	}
+
+	common := candidates[0]
+	for _, name := range candidates[1:] {
+		for !strings.HasPrefix(name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return line[:start] + common, candidates
+}
+
+// isIdentChar matches the lexer: identifiers are letters and underscores.
+func isIdentChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+// printCompletion shows what Tab would do with line: the completed line, then
+// the candidates when more than one name still fits.
+func printCompletion(out io.Writer, line string, names []string) {
+	completed, candidates := complete(line, names)
+	if len(candidates) == 0 {
+		io.WriteString(out, "no completions\n")
+		return
+	}
+
+	fmt.Fprintf(out, "%s\n", completed)
+	if len(candidates) > 1 {
+		fmt.Fprintf(out, "  %s\n", strings.Join(candidates, "  "))
+	}
+}
@@ -0,0 +1,56 @@
+package repl
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hudsn/learn-interpreter/evaluator"
+	"github.com/hudsn/learn-interpreter/object"
+)
+
+func TestComplete(t *testing.T) {
+	names := []string{"filter", "first", "flatten", "fn", "format", "len", "let", "lines", "total", "total_count"}
+
+	tests := []struct {
+		line               string
+		expectedLine       string
+		expectedCandidates []string
+	}{
+		{"fla", "flatten", []string{"flatten"}},
+		{"tot", "total", []string{"total", "total_count"}},
+		{"total_", "total_count", []string{"total_count"}},
+		{"fi", "fi", []string{"filter", "first"}},
+		{"l", "l", []string{"len", "let", "lines"}},
+		{"li", "lines", []string{"lines"}},
+		{"xyz", "xyz", nil},
+		{"let n = len(fla", "let n = len(flatten", []string{"flatten"}},
+		{"puts(1 + tot", "puts(1 + total", []string{"total", "total_count"}},
+		{"[first, fi", "[first, fi", []string{"filter", "first"}},
+		{"f(x) + zz", "f(x) + zz", nil},
+	}
+
+	for _, tt := range tests {
+		line, candidates := complete(tt.line, names)
+		if line != tt.expectedLine {
+			t.Errorf("wrong completion for %q. want=%q, got=%q", tt.line, tt.expectedLine, line)
+		}
+		if !slices.Equal(candidates, tt.expectedCandidates) {
+			t.Errorf("wrong candidates for %q. want=%v, got=%v", tt.line, tt.expectedCandidates, candidates)
+		}
+	}
+}
+
+func TestCompletionNames(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("my_value", &object.Integer{Value: 1})
+
+	names := completionNames(evaluator.New(evaluator.Options{}), env)
+	for _, want := range []string{"my_value", "len", "let", "return"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("completion names missing %q", want)
+		}
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("completion names are not sorted")
+	}
+}
@@ -0,0 +1,145 @@
+package repl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hudsn/learn-interpreter/evaluator"
+	"github.com/hudsn/learn-interpreter/lexer"
+	"github.com/hudsn/learn-interpreter/object"
+	"github.com/hudsn/learn-interpreter/parser"
+)
+
+type jsonValueResult struct {
+	OK    bool `json:"ok"`
+	Value any  `json:"value"`
+}
+
+type jsonErrorResult struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// RunJSON evaluates src like Run, but reports the outcome to opts.Output as a
+// single line of JSON: {"ok":true,"value":...} with the value of the final
+// statement, or {"ok":false,"error":"...","line":3,"column":5} if parsing,
+// evaluation, or encoding the value failed. Anything the program prints with puts comes before it.
+// The returned error is non-nil when the program failed, so callers can set
+// an exit status.
+func RunJSON(src string, opts evaluator.Options) error {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+
+	var result any
+	var runErr error
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		runErr = fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), "; "))
+		result = jsonErrorResult{Error: runErr.Error()}
+	} else {
+		evaluated := evaluator.New(opts).Eval(program, object.NewEnvironment())
+		if errObj, ok := evaluated.(*object.Error); ok {
+			runErr = fmt.Errorf("%s", errObj.Message)
+			result = jsonErrorResult{Error: errObj.Message, Line: errObj.Line, Column: errObj.Column}
+		} else if value, err := toJSON(evaluated); err != nil {
+			runErr = err
+			result = jsonErrorResult{Error: err.Error()}
+		} else {
+			result = jsonValueResult{OK: true, Value: value}
+		}
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.Output, "%s\n", encoded)
+	return runErr
+}
+
+type jsonMember struct {
+	Key   string
+	Value any
+}
+
+// jsonObject encodes as a JSON object whose members keep the hash's
+// insertion order, which a Go map would lose.
+type jsonObject []jsonMember
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// toJSON maps a Monkey value onto the value encoding/json should emit for it.
+// Hash keys become strings, and values without a JSON counterpart, such as
+// functions, are represented by their Inspect output. Since 1 and "1" would
+// both become the key "1", a hash whose keys collide that way is an error
+// rather than a JSON object with a duplicate member.
+func toJSON(obj object.Object) (any, error) {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := toJSON(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		members := jsonObject{}
+		seen := map[string]object.Object{}
+		for _, pair := range obj.OrderedPairs() {
+			key := pair.Key.Inspect()
+			if other, ok := seen[key]; ok {
+				return nil, fmt.Errorf("hash keys %s and %s both encode as JSON key %q", other.Type(), pair.Key.Type(), key)
+			}
+			seen[key] = pair.Key
+
+			value, err := toJSON(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, jsonMember{Key: key, Value: value})
+		}
+		return members, nil
+	default:
+		return obj.Inspect(), nil
+	}
+}
@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hudsn/learn-interpreter/evaluator"
+)
+
+func TestRunJSONValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`5`, `{"ok":true,"value":5}`},
+		{`"a\"b"`, `{"ok":true,"value":"a\"b"}`},
+		{`true`, `{"ok":true,"value":true}`},
+		{`null`, `{"ok":true,"value":null}`},
+		{`let x = 1;`, `{"ok":true,"value":null}`},
+		{`[1, "two", [false]]`, `{"ok":true,"value":[1,"two",[false]]}`},
+		{`{"b": 1, "a": {2: [3]}, true: null}`, `{"ok":true,"value":{"b":1,"a":{"2":[3]},"true":null}}`},
+		{`fn(x) { x }`, `{"ok":true,"value":"fn(x) {\nx\n}"}`},
+		{`puts("hi"); 1`, "hi\n" + `{"ok":true,"value":1}`},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := RunJSON(tt.input, evaluator.Options{Output: &out}); err != nil {
+			t.Errorf("RunJSON(%q) returned error: %v", tt.input, err)
+		}
+		if got := out.String(); got != tt.expected+"\n" {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected+"\n", got)
+		}
+	}
+}
+
+func TestRunJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nx + true", `{"ok":false,"error":"unknown operator: INTEGER + BOOLEAN","line":2,"column":3}`},
+		{`let x = `, `{"ok":false,"error":"parser errors: no prefix parse function for EOF found"}`},
+		{`{1: "a", "1": "b"}`, `{"ok":false,"error":"hash keys INTEGER and STRING both encode as JSON key \"1\""}`},
+		{`[{"true": 1, true: 2}]`, `{"ok":false,"error":"hash keys STRING and BOOLEAN both encode as JSON key \"true\""}`},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := RunJSON(tt.input, evaluator.Options{Output: &out}); err == nil {
+			t.Errorf("RunJSON(%q) returned no error", tt.input)
+		}
+		if got := out.String(); got != tt.expected+"\n" {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected+"\n", got)
+		}
+	}
+}
@@ -2,8 +2,14 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hudsn/learn-interpreter/evaluator"
 	"github.com/hudsn/learn-interpreter/lexer"
@@ -13,30 +19,135 @@ import (
 
 const PROMPT = ">>"
 
+// defaultDisplayLimit is how many leading array elements the REPL prints
+// before eliding the rest; :limit changes it.
+const defaultDisplayLimit = 100
+
+// maxVarWidth caps how much of a value :vars prints before truncating it.
+const maxVarWidth = 40
+
+// ansiRed and ansiReset wrap error output when color is enabled.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiReset = "\x1b[0m"
+)
+
+// Options configures an interactive session.
+type Options struct {
+	// Prompt is printed before each line of input. Empty means PROMPT.
+	Prompt string
+	// Color prints errors in red using ANSI escapes. Callers decide whether
+	// the output is a terminal that wants them.
+	Color bool
+	// MaxOps bounds how many operations each line may evaluate, as in
+	// evaluator.Options. Zero means no limit.
+	MaxOps int
+}
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWith(in, out, Options{MaxOps: evaluator.DefaultMaxOps})
+}
+
+// StartWith runs the REPL like Start, configured by opts.
+func StartWith(in io.Reader, out io.Writer, opts Options) {
+	prompt := opts.Prompt
+	if prompt == "" {
+		prompt = PROMPT
+	}
+
+	// The prompt and the input builtin share one buffered reader, so neither
+	// swallows lines meant for the other.
+	reader := bufio.NewReader(in)
 	env := object.NewEnvironment()
+	ev := evaluator.New(evaluator.Options{Output: out, Input: reader, AllowIO: true, MaxOps: opts.MaxOps})
+	pretty := false
+	timed := false
+	limit := defaultDisplayLimit
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		fmt.Fprint(out, prompt)
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
 			return
 		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		switch strings.TrimSpace(line) {
+		case ":pretty":
+			pretty = !pretty
+			fmt.Fprintf(out, "pretty printing %s\n", onOff(pretty))
+			continue
+		case ":time":
+			timed = !timed
+			fmt.Fprintf(out, "evaluation timing %s\n", onOff(timed))
+			continue
+		case ":vars":
+			printVars(out, env)
+			continue
+		case ":help":
+			printHelp(out, ev)
+			continue
+		case ":reset":
+			// builtins aren't stored in env, so they survive this
+			env = object.NewEnvironment()
+			io.WriteString(out, "environment reset\n")
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), ":unset "); ok {
+			unset(out, env, strings.TrimSpace(name))
+			continue
+		}
+		if arg, ok := strings.CutPrefix(strings.TrimSpace(line), ":limit "); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil || n < 0 {
+				fmt.Fprintf(out, "usage: :limit n (0 shows everything)\n")
+				continue
+			}
+			limit = n
+			fmt.Fprintf(out, "display limit %d\n", limit)
+			continue
+		}
+		if text, ok := strings.CutPrefix(strings.TrimLeft(line, " \t"), ":complete "); ok {
+			printCompletion(out, text, completionNames(ev, env))
+			continue
+		}
+		if src, ok := strings.CutPrefix(strings.TrimSpace(line), ":ast-string "); ok {
+			printASTString(out, src, opts.Color)
+			continue
+		}
+		if path, ok := strings.CutPrefix(strings.TrimSpace(line), ":load "); ok {
+			load(out, ev, env, strings.TrimSpace(path), opts.Color)
+			continue
+		}
 
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, p.Errors(), opts.Color)
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
+		var start time.Time
+		if timed {
+			start = time.Now()
+		}
+		evaluated := ev.Eval(program, env)
+		var elapsed time.Duration
+		if timed {
+			elapsed = time.Since(start)
+		}
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			printError(out, errObj, opts.Color)
+			printErrorPosition(out, line, errObj, opts.Color)
+		} else if evaluated != nil {
+			io.WriteString(out, inspect(evaluated, pretty, limit))
 			io.WriteString(out, "\n")
 		}
+		if timed {
+			fmt.Fprintf(out, "(took %s)\n", elapsed.Round(time.Microsecond))
+		}
 
 		// for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
 		// 	fmt.Fprintf(out, "%+v\n", tok)
@@ -44,12 +155,246 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+// Run evaluates src as a whole program, the way script files are run, with an
+// Evaluator configured by opts. puts writes to opts.Output. When printResult
+// is set the value of the final statement is written there as well, mirroring
+// the REPL; a top-level return ends the program early and its value is the
+// one printed. Parser errors and runtime errors are returned rather than
+// printed.
+func Run(src string, opts evaluator.Options, printResult bool) error {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	out := opts.Output
+
+	ev := evaluator.New(opts)
+	evaluated := ev.Eval(program, object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); ok {
+		var b strings.Builder
+		b.WriteString(errObj.Inspect())
+		b.WriteString("\n")
+		printStackTrace(&b, errObj.StackTrace)
+		return errors.New(strings.TrimSuffix(b.String(), "\n"))
+	}
+
+	if printResult && evaluated != nil {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
+	return nil
+}
+
+func printParserErrors(out io.Writer, errors []string, color bool) {
 	io.WriteString(out, MONKEY_FACE)
-	io.WriteString(out, "Whoos! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
+	io.WriteString(out, paint("Whoos! We ran into some monkey business here!\n", ansiRed, color))
+	io.WriteString(out, paint(" parser errors:\n", ansiRed, color))
 	for _, err := range errors {
-		fmt.Fprintf(out, "\t%s\n", err)
+		io.WriteString(out, paint(fmt.Sprintf("\t%s\n", err), ansiRed, color))
+	}
+}
+
+func printError(out io.Writer, errObj *object.Error, color bool) {
+	var b strings.Builder
+	b.WriteString(errObj.Inspect())
+	b.WriteString("\n")
+	printStackTrace(&b, errObj.StackTrace)
+	io.WriteString(out, paint(b.String(), ansiRed, color))
+}
+
+// printErrorPosition echoes the input line with a caret under the column the
+// error came from. Errors raised inside a function point into that function's
+// source, which may have been entered on an earlier line, so those are left
+// to the stack trace.
+func printErrorPosition(out io.Writer, line string, errObj *object.Error, color bool) {
+	if errObj.Line != 1 || errObj.Column < 1 || errObj.Column > len(line) || len(errObj.StackTrace) != 0 {
+		return
+	}
+
+	// keep tabs so the caret lines up however wide the terminal shows them
+	var pad strings.Builder
+	for _, r := range line[:errObj.Column-1] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	fmt.Fprintf(out, "  %s\n", line)
+	io.WriteString(out, paint("  "+pad.String()+"^\n", ansiRed, color))
+}
+
+// paint wraps each line of s in the given ANSI color, leaving line breaks
+// outside the escapes so a terminal never carries the color onto the next
+// prompt.
+func paint(s string, color string, enabled bool) string {
+	if !enabled {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		text, newline := strings.CutSuffix(line, "\n")
+		if text == "" {
+			continue
+		}
+		lines[i] = color + text + ansiReset
+		if newline {
+			lines[i] += "\n"
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// inspect formats a result for the prompt. Compact output shortens long
+// arrays to limit elements, including those inside hashes; pretty output is
+// always complete.
+func inspect(obj object.Object, pretty bool, limit int) string {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if pretty {
+			return obj.InspectIndented()
+		}
+		return obj.InspectTruncated(limit)
+	case *object.Hash:
+		if pretty {
+			return obj.InspectIndented()
+		}
+		return obj.InspectTruncated(limit)
+	}
+	return obj.Inspect()
+}
+
+func printVars(out io.Writer, env *object.Environment) {
+	names := env.Names()
+	if len(names) == 0 {
+		io.WriteString(out, "no bindings defined\n")
+		return
+	}
+
+	for _, name := range names {
+		obj, _ := env.Get(name)
+		if fn, ok := obj.(*object.Function); ok {
+			fmt.Fprintf(out, "%s: %s %s\n", name, fn.Type(), fn.Signature())
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s = %s\n", name, obj.Type(), truncate(obj.Inspect(), maxVarWidth))
+	}
+}
+
+// metaCommands describes the REPL's commands for :help, in display order.
+var metaCommands = [][2]string{
+	{":help", "list builtins and REPL commands"},
+	{":pretty", "toggle indented printing of arrays and hashes"},
+	{":time", "toggle printing how long each evaluation took"},
+	{":limit n", "print at most n leading array elements (0 for all)"},
+	{":vars", "list the bindings in the environment"},
+	{":reset", "clear every binding"},
+	{":unset name", "remove one binding"},
+	{":load path", "evaluate a file into the environment"},
+	{":complete text", "complete the name at the end of text, listing the candidates"},
+	{":ast-string src", "print src as the parser understood it, with explicit grouping"},
+}
+
+func printHelp(out io.Writer, ev *evaluator.Evaluator) {
+	builtins := ev.Builtins()
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	io.WriteString(out, "builtins:\n")
+	for _, name := range names {
+		doc := builtins[name].Doc
+		if doc == "" {
+			doc = name
+		}
+		fmt.Fprintf(out, "  %-16s %s\n", name, doc)
+	}
+
+	io.WriteString(out, "commands:\n")
+	for _, cmd := range metaCommands {
+		fmt.Fprintf(out, "  %-16s %s\n", cmd[0], cmd[1])
+	}
+}
+
+// load evaluates a file into the session's environment so its top-level
+// bindings become available at the prompt. Errors are reported, not fatal.
+func load(out io.Writer, ev *evaluator.Evaluator, env *object.Environment, path string, color bool) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		io.WriteString(out, paint(fmt.Sprintf("could not load %s: %s\n", path, err), ansiRed, color))
+		return
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors(), color)
+		return
+	}
+
+	if errObj, ok := ev.Eval(program, env).(*object.Error); ok {
+		printError(out, errObj, color)
+		return
+	}
+	fmt.Fprintf(out, "loaded %s\n", path)
+}
+
+// printASTString shows how src parses without evaluating it.
+func printASTString(out io.Writer, src string, color bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors(), color)
+		return
+	}
+	io.WriteString(out, program.String())
+	io.WriteString(out, "\n")
+}
+
+func unset(out io.Writer, env *object.Environment, name string) {
+	if !env.Delete(name) {
+		fmt.Fprintf(out, "%s is not defined\n", name)
+		return
+	}
+	fmt.Fprintf(out, "unset %s\n", name)
+}
+
+// truncate flattens s onto one line and shortens it to at most width runes.
+func truncate(s string, width int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// maxTraceFrames limits how much of a stack trace is printed, since runaway
+// recursion can produce thousands of identical frames.
+const maxTraceFrames = 20
+
+func printStackTrace(out io.Writer, frames []string) {
+	for i, frame := range frames {
+		if i == maxTraceFrames {
+			fmt.Fprintf(out, "\t... %d more\n", len(frames)-maxTraceFrames)
+			break
+		}
+		fmt.Fprintf(out, "\tat %s\n", frame)
 	}
 }
 
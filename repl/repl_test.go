@@ -0,0 +1,172 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// session feeds input to a REPL line by line and returns everything it wrote,
+// prompts included.
+func session(input string, opts Options) string {
+	var out bytes.Buffer
+	StartWith(strings.NewReader(input), &out, opts)
+	return out.String()
+}
+
+func TestVarsCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":vars\n", ">>no bindings defined\n>>"},
+		{
+			"let x = 5\nlet f = fn(a, b = 1) { a }\nlet s = \"" + strings.Repeat("a", 50) + "\"\n:vars\n",
+			">>>>>>>>f: FUNCTION fn(a, b = 1)\ns: STRING = " + strings.Repeat("a", 37) + "...\nx: INTEGER = 5\n>>",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := session(tt.input, Options{}); got != tt.expected {
+			t.Errorf("wrong transcript for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	got := session(":time\n1 + 1\nlet x = 1\n:time\n2\n", Options{})
+
+	timing := regexp.MustCompile(`\(took [0-9.]+[nµm]?s\)`)
+	expected := ">>evaluation timing on\n>>2\n(took)\n>>(took)\n>>evaluation timing off\n>>2\n>>"
+	if normalized := timing.ReplaceAllString(got, "(took)"); normalized != expected {
+		t.Errorf("wrong transcript.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestRunawayTailCallStops(t *testing.T) {
+	got := session("let f = fn(){ f() }; f()\n1\n", Options{MaxOps: 10000})
+
+	expected := ">>ERROR: operation limit exceeded\n\tat f (line 1)\n>>1\n>>"
+	if got != expected {
+		t.Errorf("wrong transcript.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestUnsetCommand(t *testing.T) {
+	got := session("let x = 1\nlet y = 2\n:unset x\nx\ny\n:unset x\n", Options{})
+
+	expected := ">>>>>>unset x\n>>ERROR: identifier not found: x\n  x\n  ^\n>>2\n>>x is not defined\n>>"
+	if got != expected {
+		t.Errorf("wrong transcript.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.mk":    "let double = fn(x) { x * 2 };\nlet base = 20;",
+		"broken.mk": "let x = ;",
+		"fails.mk":  "let ok = 1;\nok + true;",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib := filepath.Join(dir, "lib.mk")
+	broken := filepath.Join(dir, "broken.mk")
+	fails := filepath.Join(dir, "fails.mk")
+	missing := filepath.Join(dir, "missing.mk")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":load " + lib + "\ndouble(base) + 2\n", ">>loaded " + lib + "\n>>42\n>>"},
+		{":load " + missing + "\n", ">>could not load " + missing + ": open " + missing + ": no such file or directory\n>>"},
+		{":load " + broken + "\n", ">>" + MONKEY_FACE + "Whoos! We ran into some monkey business here!\n parser errors:\n\tno prefix parse function for ; found\n>>"},
+		// bindings made before the failure are kept
+		{":load " + fails + "\nok\n", ">>ERROR: unknown operator: INTEGER + BOOLEAN\n>>1\n>>"},
+	}
+
+	for _, tt := range tests {
+		if got := session(tt.input, Options{}); got != tt.expected {
+			t.Errorf("wrong transcript for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestResetCommand(t *testing.T) {
+	got := session("let x = 1\n:reset\nx\nlen([1])\n:vars\n", Options{})
+
+	// builtins live outside the environment, so they survive a reset
+	expected := ">>>>environment reset\n>>ERROR: identifier not found: x\n  x\n  ^\n>>1\n>>no bindings defined\n>>"
+	if got != expected {
+		t.Errorf("wrong transcript.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestLimitCommand(t *testing.T) {
+	got := session(":limit 3\nrange(10)\n{\"a\": range(200)}\n:limit 0\n{\"a\": range(6)}\n:limit x\n", Options{})
+
+	expected := ">>display limit 3\n" +
+		">>[0, 1, 2, ... (5 more), 8, 9]\n" +
+		">>{a: [0, 1, 2, ... (195 more), 198, 199]}\n" +
+		">>display limit 0\n" +
+		">>{a: [0, 1, 2, 3, 4, 5]}\n" +
+		">>usage: :limit n (0 shows everything)\n>>"
+	if got != expected {
+		t.Errorf("wrong transcript.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestPromptAndColorOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     Options
+		expected string
+	}{
+		{"1\n", Options{Prompt: "monkey> "}, "monkey> 1\nmonkey> "},
+		{"len(1)\n", Options{Prompt: "$ "}, "$ ERROR: argument to `len` must be STRING, ARRAY, or HASH, got INTEGER\n  len(1)\n  ^\n$ "},
+		{"1\n", Options{Color: true}, ">>1\n>>"},
+		{
+			"len(1)\n",
+			Options{Color: true},
+			">>\x1b[31mERROR: argument to `len` must be STRING, ARRAY, or HASH, got INTEGER\x1b[0m\n  len(1)\n\x1b[31m  ^\x1b[0m\n>>",
+		},
+		{
+			"let = 1\n",
+			Options{Color: true},
+			">>" + MONKEY_FACE + "\x1b[31mWhoos! We ran into some monkey business here!\x1b[0m\n\x1b[31m parser errors:\x1b[0m\n\x1b[31m\texpected next token to be IDENT, got = instead\x1b[0m\n>>",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := session(tt.input, tt.opts); got != tt.expected {
+			t.Errorf("wrong transcript for %q with %+v.\nwant=%q\ngot= %q", tt.input, tt.opts, tt.expected, got)
+		}
+	}
+}
+
+func TestErrorCaret(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true\n", ">>ERROR: unknown operator: INTEGER + BOOLEAN\n  1 + true\n    ^\n>>"},
+		{"  let y = 2 * \"a\"\n", ">>ERROR: type mismatch: INTEGER * STRING\n    let y = 2 * \"a\"\n              ^\n>>"},
+		{"\tmissing\n", ">>ERROR: identifier not found: missing\n  \tmissing\n  \t^\n>>"},
+		{"let xs = [1]; xs[5] = 1\n", ">>ERROR: index out of range: 5 (length 1)\n  let xs = [1]; xs[5] = 1\n                      ^\n>>"},
+		// errors raised inside a function are located by the stack trace
+		{"let f = fn() { 1 + true }\nf()\n", ">>>>ERROR: unknown operator: INTEGER + BOOLEAN\n\tat f (line 1)\n>>"},
+	}
+
+	for _, tt := range tests {
+		if got := session(tt.input, Options{}); got != tt.expected {
+			t.Errorf("wrong transcript for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}